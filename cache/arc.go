@@ -0,0 +1,83 @@
+package cache
+
+// arcQueue implements the Adaptive Replacement Cache policy.
+//
+// Keys seen once live in t1 and keys seen at least twice in t2, b1 and b2 remember the keys
+// recently evicted from each of them. Hits on those ghost lists move the target size p of t1,
+// so the policy adapts between recency and frequency. As the cache is bounded by bytes rather
+// than by entries, the ARC size c is the highest number of resident keys observed so far.
+type arcQueue struct {
+	t1, t2, b1, b2 *lruQueue
+	p, c           int
+}
+
+// NewARCPolicy returns a policy implementing the Adaptive Replacement Cache algorithm.
+func NewARCPolicy() EvictionPolicy {
+	return &arcQueue{
+		t1: newLRUQueue(),
+		t2: newLRUQueue(),
+		b1: newLRUQueue(),
+		b2: newLRUQueue(),
+	}
+}
+
+func (q *arcQueue) Add(key uint64) {
+	switch {
+	case q.t1.contains(key), q.t2.contains(key):
+		q.Access(key)
+		return
+	case q.b1.contains(key):
+		q.p = min(q.p+max(q.b2.len()/q.b1.len(), 1), q.c)
+		q.b1.remove(key)
+		q.t2.moveToFront(key)
+	case q.b2.contains(key):
+		q.p = max(q.p-max(q.b1.len()/q.b2.len(), 1), 0)
+		q.b2.remove(key)
+		q.t2.moveToFront(key)
+	default:
+		q.t1.moveToFront(key)
+	}
+
+	q.c = max(q.c, q.t1.len()+q.t2.len())
+}
+
+func (q *arcQueue) Access(key uint64) {
+	if q.t1.contains(key) {
+		q.t1.remove(key)
+		q.t2.moveToFront(key)
+		return
+	}
+
+	if q.t2.contains(key) {
+		q.t2.moveToFront(key)
+	}
+}
+
+func (q *arcQueue) Remove(key uint64) {
+	q.t1.remove(key)
+	q.t2.remove(key)
+}
+
+func (q *arcQueue) Evict() (uint64, bool) {
+	var key uint64
+	var ok bool
+	if q.t1.len() > 0 && (q.t1.len() > q.p || q.t2.len() == 0) {
+		key, ok = q.t1.removeFromTail()
+		q.b1.moveToFront(key)
+	} else {
+		key, ok = q.t2.removeFromTail()
+		if ok {
+			q.b2.moveToFront(key)
+		}
+	}
+
+	// Keep |t1|+|b1| <= c and the whole directory within 2c.
+	for q.b1.len() > 0 && q.t1.len()+q.b1.len() > q.c {
+		q.b1.removeFromTail()
+	}
+	for q.b2.len() > 0 && q.t1.len()+q.t2.len()+q.b1.len()+q.b2.len() > 2*q.c {
+		q.b2.removeFromTail()
+	}
+
+	return key, ok
+}
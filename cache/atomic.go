@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+// Number is the constraint of the values of counter caches, see Increment.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// compute calls fn with the live entry of the key, or nil, under the lock of the key's shard.
+// The entry returned by fn, if any, is stored like Set does. compute reports whether an entry was stored.
+func (c *engine[K, V]) compute(key K, fn func(old *CacheEntry[K, V]) *CacheEntry[K, V]) bool {
+	if !c.computeLocal(key, fn) {
+		return false
+	}
+	c.enforceQuota(c.namespaceOf(key))
+	c.publishKeys(key)
+	return true
+}
+
+// computeLocal is compute without publishing the invalidation of the key.
+func (c *engine[K, V]) computeLocal(key K, fn func(old *CacheEntry[K, V]) *CacheEntry[K, V]) bool {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	defer s.notify()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	old := s.get(hashKey, key)
+	if old != nil && old.expired(c.clock.Now()) {
+		s.delete(hashKey, key, EvictExpired)
+		old = nil
+	}
+
+	entry := fn(old)
+	if entry == nil {
+		return false
+	}
+	c.store(s, entry)
+	return true
+}
+
+// replacement creates the entry replacing old with data, keeping the expiration of old.
+func (c *engine[K, V]) replacement(old *CacheEntry[K, V], data V) *CacheEntry[K, V] {
+	return &CacheEntry[K, V]{
+		key:     old.key,
+		hash:    old.hash,
+		data:    data,
+		ttl:     old.ttl,
+		exp:     old.exp,
+		refresh: old.refresh,
+		size:    c.sizer(old.key, data) + tagsSize(old.tags),
+		tags:    old.tags,
+		ns:      old.ns,
+		index:   -1,
+	}
+}
+
+// SetIfAbsent sets the key like Set only if it is not in the cache, and reports whether it did.
+func (c *engine[K, V]) SetIfAbsent(key K, data V, exp time.Duration) bool {
+	return c.compute(key, func(old *CacheEntry[K, V]) *CacheEntry[K, V] {
+		if old != nil {
+			return nil
+		}
+		return c.newEntry(key, data, exp, c.sizer(key, data))
+	})
+}
+
+// Replace sets the key like Set only if it is already in the cache, and reports whether it did.
+func (c *engine[K, V]) Replace(key K, data V, exp time.Duration) bool {
+	return c.compute(key, func(old *CacheEntry[K, V]) *CacheEntry[K, V] {
+		if old == nil {
+			return nil
+		}
+		return c.newEntry(key, data, exp, c.sizer(key, data))
+	})
+}
+
+// CompareAndSwap replaces the value of the key with new if its current value equals old,
+// and reports whether it did. The entry keeps its expiration.
+// Values are compared with equal, or reflect.DeepEqual when equal is nil.
+func (c *engine[K, V]) CompareAndSwap(key K, old, new V, equal func(a, b V) bool) bool {
+	if equal == nil {
+		equal = func(a, b V) bool {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+
+	return c.compute(key, func(current *CacheEntry[K, V]) *CacheEntry[K, V] {
+		if current == nil || !equal(current.data, old) {
+			return nil
+		}
+		return c.replacement(current, new)
+	})
+}
+
+// Update atomically replaces the value of the key with the one returned by fn, called with the
+// current value and whether the key is in the cache. The cache is left unchanged if fn returns false.
+// An existing entry keeps its expiration, a new one expires after the default TTL, see DefaultExpiration.
+// fn runs under the lock of the key's shard and must not use the cache.
+func (c *engine[K, V]) Update(key K, fn func(old V, ok bool) (V, bool)) bool {
+	return c.compute(key, func(old *CacheEntry[K, V]) *CacheEntry[K, V] {
+		if old == nil {
+			data, ok := fn(zero[V](), false)
+			if !ok {
+				return nil
+			}
+			return c.newEntry(key, data, DefaultExpiration, c.sizer(key, data))
+		}
+
+		data, ok := fn(old.data, true)
+		if !ok {
+			return nil
+		}
+		return c.replacement(old, data)
+	})
+}
+
+// Increment atomically adds delta to the value of the key and returns the new value.
+// A missing key counts from zero and expires after the default TTL, see Update.
+func Increment[T Number](c *Cache[T], key string, delta T) T {
+	var result T
+	c.Update(key, func(old T, _ bool) (T, bool) {
+		result = old + delta
+		return result, true
+	})
+	return result
+}
+
+// Decrement atomically subtracts delta from the value of the key and returns the new value.
+// A missing key counts from zero and expires after the default TTL, see Update.
+func Decrement[T Number](c *Cache[T], key string, delta T) T {
+	var result T
+	c.Update(key, func(old T, _ bool) (T, bool) {
+		result = old - delta
+		return result, true
+	})
+	return result
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Backend, and by Tiered, when a key is not stored or has expired.
+var ErrNotFound = errors.New("cache: key not found")
+
+// Backend is a second level store for a Tiered cache, e.g. a Redis client.
+// Values are opaque payloads encoded by the codec of the Tiered cache.
+type Backend interface {
+	// Get returns the value of the key and its remaining expiration duration, or NoExpiration.
+	// It returns ErrNotFound when the key is not stored or has expired.
+	Get(ctx context.Context, key string) ([]byte, time.Duration, error)
+	// Set stores the value of the key for the expiration duration, forever with NoExpiration.
+	Set(ctx context.Context, key string, value []byte, exp time.Duration) error
+	// Delete removes the key, it is not an error if the key is not stored.
+	Delete(ctx context.Context, key string) error
+}
+
+// remaining returns the expiration duration left at now until exp, NoExpiration when exp is zero.
+func remaining(now, exp time.Time) time.Duration {
+	if exp.IsZero() {
+		return NoExpiration
+	}
+	return exp.Sub(now)
+}
+
+// deadline returns the expiration time of a value stored at now for exp, zero with NoExpiration.
+func deadline(now time.Time, exp time.Duration) time.Time {
+	if exp == NoExpiration {
+		return time.Time{}
+	}
+	return now.Add(exp)
+}
+
+type memoryValue struct {
+	data []byte
+	exp  time.Time
+}
+
+// MemoryBackend is a Backend keeping the values in memory, mostly useful for tests.
+// Expired values are removed when they are read.
+type MemoryBackend struct {
+	mu     sync.RWMutex
+	values map[string]memoryValue
+}
+
+// NewMemoryBackend creates an empty in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		values: make(map[string]memoryValue),
+	}
+}
+
+func (b *MemoryBackend) Get(_ context.Context, key string) ([]byte, time.Duration, error) {
+	b.mu.RLock()
+	value, ok := b.values[key]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+
+	now := time.Now()
+	if !value.exp.IsZero() && !now.Before(value.exp) {
+		b.mu.Lock()
+		if current, ok := b.values[key]; ok && current.exp.Equal(value.exp) {
+			delete(b.values, key)
+		}
+		b.mu.Unlock()
+		return nil, 0, ErrNotFound
+	}
+	return append([]byte(nil), value.data...), remaining(now, value.exp), nil
+}
+
+func (b *MemoryBackend) Set(_ context.Context, key string, value []byte, exp time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.values[key] = memoryValue{data: append([]byte(nil), value...), exp: deadline(time.Now(), exp)}
+	return nil
+}
+
+func (b *MemoryBackend) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.values, key)
+	return nil
+}
+
+// FileBackend is a Backend storing each value in its own file of a directory.
+// A file holds the expiration time of the value as big-endian Unix nanoseconds, zero for
+// values that never expire, followed by the value. Files are replaced atomically by renaming,
+// expired files are removed when they are read.
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend creates a backend storing its files in dir, creating the directory if needed.
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating directory: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// path returns the file of the key, named after its SHA-256 hash so that any key is a valid name.
+func (b *FileBackend) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(b.dir, hex.EncodeToString(sum[:]))
+}
+
+func (b *FileBackend) Get(_ context.Context, key string) ([]byte, time.Duration, error) {
+	fp := b.path(key)
+	data, err := os.ReadFile(fp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading file: %w", err)
+	}
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("reading file %s: truncated header", fp)
+	}
+
+	var exp time.Time
+	if nanos := int64(binary.BigEndian.Uint64(data)); nanos != 0 {
+		exp = time.Unix(0, nanos)
+	}
+	now := time.Now()
+	if !exp.IsZero() && !now.Before(exp) {
+		if err := os.Remove(fp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, fmt.Errorf("removing file: %w", err)
+		}
+		return nil, 0, ErrNotFound
+	}
+	return data[8:], remaining(now, exp), nil
+}
+
+func (b *FileBackend) Set(_ context.Context, key string, value []byte, exp time.Duration) error {
+	file, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	var header [8]byte
+	if t := deadline(time.Now(), exp); !t.IsZero() {
+		binary.BigEndian.PutUint64(header[:], uint64(t.UnixNano()))
+	}
+	if _, err := file.Write(header[:]); err != nil {
+		file.Close()
+		return fmt.Errorf("writing file: %w", err)
+	}
+	if _, err := file.Write(value); err != nil {
+		file.Close()
+		return fmt.Errorf("writing file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
+	if err := os.Rename(file.Name(), b.path(key)); err != nil {
+		return fmt.Errorf("renaming file: %w", err)
+	}
+	return nil
+}
+
+func (b *FileBackend) Delete(_ context.Context, key string) error {
+	if err := os.Remove(b.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package cache
+
+import "time"
+
+// keyRef is a key with its hash, grouped by shard for the batch operations.
+type keyRef[K comparable] struct {
+	key  K
+	hash uint64
+}
+
+// groupKeys groups the keys by the index of their shard.
+func (c *engine[K, V]) groupKeys(keys []K) map[uint64][]keyRef[K] {
+	groups := make(map[uint64][]keyRef[K])
+	for _, key := range keys {
+		hashKey := c.hasher(key)
+		i := hashKey & c.shardMask
+		groups[i] = append(groups[i], keyRef[K]{key: key, hash: hashKey})
+	}
+	return groups
+}
+
+// GetMany returns the live values of the keys found in the cache, locking each shard once.
+func (c *engine[K, V]) GetMany(keys []K) map[K]V {
+	result := make(map[K]V, len(keys))
+	var hits, misses uint64
+	var refreshes []K
+	now := c.clock.Now()
+	for i, refs := range c.groupKeys(keys) {
+		s := c.shards[i]
+		s.locker.Lock()
+		for _, ref := range refs {
+			data, ok, refresh := c.lookup(s, ref.hash, ref.key, now)
+			if ok {
+				result[ref.key] = data
+				hits++
+			} else {
+				misses++
+			}
+			c.lookedUp(ref.key, ok)
+			if refresh {
+				refreshes = append(refreshes, ref.key)
+			}
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+
+	c.stats.hits.Add(hits)
+	c.stats.misses.Add(misses)
+	for _, key := range refreshes {
+		c.refresh(key)
+	}
+	return result
+}
+
+// SetMany sets all the items with the same expiration duration, locking each shard once
+// and evicting entries once all the items of the shard are stored.
+func (c *engine[K, V]) SetMany(items map[K]V, exp time.Duration) {
+	groups := make(map[uint64][]*CacheEntry[K, V])
+	for key, data := range items {
+		entry := c.newEntry(key, data, exp, c.sizer(key, data))
+		i := entry.hash & c.shardMask
+		groups[i] = append(groups[i], entry)
+	}
+
+	for i, entries := range groups {
+		s := c.shards[i]
+		s.locker.Lock()
+		for _, entry := range entries {
+			s.set(entry)
+		}
+		for s.full() {
+			if !s.evict() {
+				break
+			}
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+	c.stats.sets.Add(uint64(len(items)))
+	for _, entries := range groups {
+		for _, entry := range entries {
+			c.enforceQuota(entry.ns)
+		}
+	}
+
+	if c.invalidator != nil && len(items) > 0 {
+		keys := make([]K, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		c.publishKeys(keys...)
+	}
+}
+
+// DeleteMany removes the keys from the cache, locking each shard once.
+func (c *engine[K, V]) DeleteMany(keys []K) {
+	c.deleteMany(keys)
+	c.publishKeys(keys...)
+}
+
+func (c *engine[K, V]) deleteMany(keys []K) {
+	for i, refs := range c.groupKeys(keys) {
+		s := c.shards[i]
+		s.locker.Lock()
+		for _, ref := range refs {
+			s.delete(ref.hash, ref.key, EvictDeleted)
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+}
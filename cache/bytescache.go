@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// bytesHeaderSize is the size of the header preceding the key and value of a BytesCache entry:
+// the expiration time as Unix nanoseconds, zero for entries that never expire, the key hash,
+// the key length and the value length.
+const bytesHeaderSize = 8 + 8 + 2 + 4
+
+// BytesCache is a cache of byte slices for large numbers of entries, designed to keep the work of the
+// garbage collector low. Each shard copies its entries in a preallocated ring buffer indexed by a map
+// without pointers, so the collector never scans the entries.
+//
+// Entries are evicted in insertion order when the ring buffer is full, the space of deleted, replaced and
+// expired entries is only reclaimed by eviction. Keys whose hashes collide replace each other, and keys
+// longer than 64 KB or entries larger than the shard capacity are not kept.
+type BytesCache struct {
+	shards    []*bytesShard
+	shardMask uint64
+	clock     Clock
+}
+
+// bytesShard is an independently locked ring buffer of entries.
+// The entries are stored in [head, tail), or in [head, end) then [0, tail) once the buffer wrapped.
+type bytesShard struct {
+	mu      sync.RWMutex
+	index   map[uint64]uint32
+	buf     []byte
+	head    int
+	tail    int
+	end     int
+	wrapped bool
+	// entries is the number of entries in the buffer, including the stale ones.
+	entries int
+}
+
+// NewBytesCache creates a byte cache with the capacity, shards and clock options, the other options are ignored.
+// The capacity is allocated upfront, split evenly between the shards, each one being bounded to 4 GB.
+func NewBytesCache(options ...CacheOption) *BytesCache {
+	o := Options{shards: 1, clock: SystemClock{}}
+	for _, option := range options {
+		option.apply(&o)
+	}
+	if o.capacity == 0 {
+		o.capacity = defaultCapacity
+	}
+
+	noShards := nextPowerOfTwo(max(o.shards, 1))
+	c := &BytesCache{
+		shards:    make([]*bytesShard, noShards),
+		shardMask: uint64(noShards - 1),
+		clock:     o.clock,
+	}
+	shardCapacity := min(o.capacity/uint64(noShards), math.MaxUint32)
+	for i := range c.shards {
+		c.shards[i] = &bytesShard{
+			index: make(map[uint64]uint32),
+			buf:   make([]byte, shardCapacity),
+		}
+	}
+	return c
+}
+
+func (c *BytesCache) shard(hashKey uint64) *bytesShard {
+	return c.shards[hashKey&c.shardMask]
+}
+
+// Get returns a copy of the value of the key, or false if the key is not found or has expired.
+func (c *BytesCache) Get(key string) ([]byte, bool) {
+	hashKey := keyFromString(key)
+	s := c.shard(hashKey)
+	s.mu.RLock()
+	offset, ok := s.lookup(hashKey, key, c.clock.Now())
+	if !ok {
+		s.mu.RUnlock()
+		return nil, false
+	}
+	value := append([]byte(nil), s.value(offset)...)
+	s.mu.RUnlock()
+	return value, true
+}
+
+// Set copies the value of the key in the cache, evicting the oldest entries to make room for it.
+// The entry never expires when exp is NoExpiration.
+func (c *BytesCache) Set(key string, value []byte, exp time.Duration) {
+	size := bytesHeaderSize + len(key) + len(value)
+	if len(key) > math.MaxUint16 {
+		return
+	}
+
+	hashKey := keyFromString(key)
+	s := c.shard(hashKey)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if size > len(s.buf) {
+		// The entry cannot be stored, do not keep serving the previous value.
+		if offset, ok := s.index[hashKey]; ok && string(s.key(int(offset))) == key {
+			delete(s.index, hashKey)
+		}
+		return
+	}
+
+	var expiration int64
+	if exp != NoExpiration {
+		expiration = c.clock.Now().Add(exp).UnixNano()
+	}
+	offset := s.reserve(size)
+	entry := s.buf[offset : offset+size]
+	binary.LittleEndian.PutUint64(entry, uint64(expiration))
+	binary.LittleEndian.PutUint64(entry[8:], hashKey)
+	binary.LittleEndian.PutUint16(entry[16:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(entry[18:], uint32(len(value)))
+	copy(entry[bytesHeaderSize:], key)
+	copy(entry[bytesHeaderSize+len(key):], value)
+	s.index[hashKey] = uint32(offset)
+}
+
+// Delete removes the key from the cache.
+func (c *BytesCache) Delete(key string) {
+	hashKey := keyFromString(key)
+	s := c.shard(hashKey)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if offset, ok := s.index[hashKey]; ok && string(s.key(int(offset))) == key {
+		delete(s.index, hashKey)
+	}
+}
+
+// TTL returns the remaining time before the key expires, or NoExpiration for an entry that never expires.
+// It returns false if the key is not found or has expired.
+func (c *BytesCache) TTL(key string) (time.Duration, bool) {
+	hashKey := keyFromString(key)
+	s := c.shard(hashKey)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := c.clock.Now()
+	offset, ok := s.lookup(hashKey, key, now)
+	if !ok {
+		return 0, false
+	}
+	exp := s.expiration(offset)
+	if exp == 0 {
+		return NoExpiration, true
+	}
+	return time.Unix(0, exp).Sub(now), true
+}
+
+// Len returns the number of entries in the cache, including the expired entries not evicted yet.
+func (c *BytesCache) Len() int {
+	var total int
+	for _, s := range c.shards {
+		s.mu.RLock()
+		total += len(s.index)
+		s.mu.RUnlock()
+	}
+	return total
+}
+
+// lookup returns the offset of the live entry of the key, the caller must hold the lock.
+func (s *bytesShard) lookup(hashKey uint64, key string, now time.Time) (int, bool) {
+	index, ok := s.index[hashKey]
+	if !ok {
+		return 0, false
+	}
+
+	offset := int(index)
+	if string(s.key(offset)) != key {
+		return 0, false
+	}
+	if exp := s.expiration(offset); exp != 0 && exp < now.UnixNano() {
+		return 0, false
+	}
+	return offset, true
+}
+
+// reserve returns the offset of size free bytes at the tail of the buffer, evicting the oldest entries
+// until they fit. size must not exceed the buffer. The caller must hold the lock.
+func (s *bytesShard) reserve(size int) int {
+	for {
+		if s.entries == 0 {
+			s.head, s.tail, s.wrapped = 0, 0, false
+		}
+
+		if !s.wrapped {
+			if len(s.buf)-s.tail >= size {
+				break
+			}
+			// Leave the end of the buffer unused and continue at its start.
+			s.end, s.tail, s.wrapped = s.tail, 0, true
+			continue
+		}
+		if s.head-s.tail >= size {
+			break
+		}
+		s.evict()
+	}
+
+	offset := s.tail
+	s.tail += size
+	s.entries++
+	return offset
+}
+
+// evict removes the oldest entry of the buffer, the caller must hold the lock.
+func (s *bytesShard) evict() {
+	hashKey := binary.LittleEndian.Uint64(s.buf[s.head+8:])
+	if index, ok := s.index[hashKey]; ok && int(index) == s.head {
+		delete(s.index, hashKey)
+	}
+
+	s.head += s.size(s.head)
+	s.entries--
+	if s.wrapped && s.head == s.end {
+		s.head, s.wrapped = 0, false
+	}
+}
+
+func (s *bytesShard) expiration(offset int) int64 {
+	return int64(binary.LittleEndian.Uint64(s.buf[offset:]))
+}
+
+// key returns the key of the entry at offset, it is only valid until the lock is released.
+func (s *bytesShard) key(offset int) []byte {
+	keyLen := int(binary.LittleEndian.Uint16(s.buf[offset+16:]))
+	return s.buf[offset+bytesHeaderSize : offset+bytesHeaderSize+keyLen]
+}
+
+// value returns the value of the entry at offset, it is only valid until the lock is released.
+func (s *bytesShard) value(offset int) []byte {
+	keyLen := int(binary.LittleEndian.Uint16(s.buf[offset+16:]))
+	valueLen := int(binary.LittleEndian.Uint32(s.buf[offset+18:]))
+	start := offset + bytesHeaderSize + keyLen
+	return s.buf[start : start+valueLen]
+}
+
+// size returns the size of the entry at offset, header included.
+func (s *bytesShard) size(offset int) int {
+	keyLen := int(binary.LittleEndian.Uint16(s.buf[offset+16:]))
+	valueLen := int(binary.LittleEndian.Uint32(s.buf[offset+18:]))
+	return bytesHeaderSize + keyLen + valueLen
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBytesCache(t *testing.T) {
+	c := NewBytesCache(WithCapacity(1<<16), WithShards(4))
+	c.Set("key", []byte("value"), time.Minute)
+	c.Set("forever", []byte("value"), NoExpiration)
+	c.Set("expired", []byte("value"), -time.Second)
+
+	value, ok := c.Get("key")
+	if !ok || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want value", value, ok)
+	}
+	value[0] = 'V'
+	if value, _ := c.Get("key"); string(value) != "value" {
+		t.Errorf("Get() = %q, the value should be copied", value)
+	}
+	if _, ok := c.Get("expired"); ok {
+		t.Error("expired should have expired")
+	}
+	if ttl, ok := c.TTL("key"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL(key) = %v, %v", ttl, ok)
+	}
+	if ttl, ok := c.TTL("forever"); !ok || ttl != NoExpiration {
+		t.Errorf("TTL(forever) = %v, %v, want NoExpiration", ttl, ok)
+	}
+
+	c.Set("key", []byte("replaced"), time.Minute)
+	if value, _ := c.Get("key"); string(value) != "replaced" {
+		t.Errorf("Get() = %q, want replaced", value)
+	}
+	c.Delete("key")
+	if _, ok := c.Get("key"); ok {
+		t.Error("key should have been deleted")
+	}
+
+	c.Set("forever", make([]byte, 1<<16), NoExpiration)
+	if _, ok := c.Get("forever"); ok {
+		t.Error("an entry larger than the shard should not be kept")
+	}
+	c.Set(strings.Repeat("k", 1<<16), nil, NoExpiration)
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len() = %d, want only expired", n)
+	}
+}
+
+func TestBytesCacheEviction(t *testing.T) {
+	const capacity = 4096
+	c := NewBytesCache(WithCapacity(capacity))
+	value := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i)}, i%50)
+	}
+
+	for i := 0; i < 10000; i++ {
+		c.Set(fmt.Sprint(i), value(i), NoExpiration)
+
+		// The most recent entries always fit, whatever the position of the buffer.
+		for j := max(i-20, 0); j <= i; j++ {
+			got, ok := c.Get(fmt.Sprint(j))
+			if !ok || !bytes.Equal(got, value(j)) {
+				t.Fatalf("after setting %d, Get(%d) = %v, %v, want %v", i, j, got, ok, value(j))
+			}
+		}
+	}
+	if _, ok := c.Get("0"); ok {
+		t.Error("the oldest entries should have been evicted")
+	}
+	if n := c.Len(); n*bytesHeaderSize > capacity {
+		t.Errorf("Len() = %d, more than the capacity allows", n)
+	}
+}
+
+func TestBytesCacheConcurrency(t *testing.T) {
+	c := NewBytesCache(WithCapacity(1<<14), WithShards(4))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprint(i % 100)
+				c.Set(key, []byte(key), time.Minute)
+				if value, ok := c.Get(key); ok && string(value) != key {
+					t.Errorf("Get(%s) = %q", key, value)
+				}
+				if i%10 == 0 {
+					c.Delete(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkGCPause measures the duration of a full garbage collection with a million entries
+// in a Cache and in a BytesCache.
+func BenchmarkGCPause(b *testing.B) {
+	const entries = 1 << 20
+	value := []byte(dataSmall)
+
+	b.Run("Cache", func(b *testing.B) {
+		c := New[[]byte](WithShards(16), WithMaxEntries(entries), WithoutGC())
+		for i := 0; i < entries; i++ {
+			c.SetWithCost(fmt.Sprint(i), value, 1, NoExpiration)
+		}
+		benchmarkGC(b)
+		runtime.KeepAlive(c)
+	})
+	b.Run("BytesCache", func(b *testing.B) {
+		c := NewBytesCache(WithShards(16), WithCapacity(entries*uint64(64+len(value))))
+		for i := 0; i < entries; i++ {
+			c.Set(fmt.Sprint(i), value, NoExpiration)
+		}
+		benchmarkGC(b)
+		runtime.KeepAlive(c)
+	})
+}
+
+// benchmarkGC runs b.N garbage collections and reports their stop-the-world pauses.
+func benchmarkGC(b *testing.B) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(after.NumGC-before.NumGC), "pause-ns/gc")
+}
@@ -2,181 +2,368 @@
 package cache
 
 import (
+	"context"
+	"fmt"
 	"hash/fnv"
-	"maps"
+	"math"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/DmitriyVTitov/size"
+	"github.com/google/uuid"
 )
 
 const (
 	defaultGCInverval = 2 * time.Minute
-	timeSize          = 24
-	mapReferenceSize  = 24
-	uint64Size        = 8
-	rwMutexSize       = 24
-	cacheMapSize      = mapReferenceSize + 2*uint64Size + rwMutexSize
+	// NoExpiration is the expiration duration of entries that never expire.
+	NoExpiration     time.Duration = -1
+	mapReferenceSize               = 24
+	uint64Size                     = 8
+	pointerSize                    = 8
+	rwMutexSize                    = 24
+	cacheMapSize                   = mapReferenceSize + 2*uint64Size + rwMutexSize
+	// mapSlotSize is the average cost of a uint64 to pointer map slot, load factor included.
+	mapSlotSize = 32
+	// lruNodeSize is the allocation size of an eviction policy list node.
+	lruNodeSize = 32
 )
 
+// DefaultExpiration is the expiration duration of entries expiring after the default TTL of the cache,
+// see WithDefaultTTL and WithExpirationPolicy. It is distinct from 0, which still expires the entry
+// immediately.
+const DefaultExpiration time.Duration = -2
+
 var defaultCapacity uint64
 
 func init() {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	// Calculate the maximum capacity based on 12.5% of total memory, capped at 200 MB
-	defaultCapacity = min(m.Sys<<10>>3, 200*1000*1000)
+	defaultCapacity = min(m.Sys>>3, 200*1000*1000)
+}
+
+// CacheEntry holds the cached data and its expiration time.
+// Entries whose key hashes collide are chained through next.
+type CacheEntry[K comparable, V any] struct {
+	key     K
+	data    V
+	hash    uint64
+	ttl     time.Duration
+	exp     time.Time
+	refresh time.Time
+	size    uint64
+	access  uint64
+	tags    []string
+	ns      *namespace
+	// index is the position of the entry in the expiry heap of its shard.
+	index int
+	next  *CacheEntry[K, V]
 }
 
-// CacheEntry holds the cached data and its expiration time
-type CacheEntry[T any] struct {
-	data T
-	exp  time.Time
-	size uint64
+// expired reports whether the entry has expired at now, entries without expiration never do.
+func (e *CacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.exp.IsZero() && e.exp.Before(now)
 }
 
-// Cache implements a type-safe in-memory cache
+// Cache implements a type-safe in-memory cache.
+// Entries are partitioned by key hash into independently locked shards.
 type Cache[T any] struct {
-	items  map[uint64]*CacheEntry[T]
-	locker *sync.RWMutex
+	engine[string, T]
+}
 
-	lruList *lruQueue
-	size    uint64
+// engine is the sharded cache shared by Cache and KCache, keyed by any comparable type.
+// The features built on string keys, namespaces, prefixes and invalidators, are only enabled by Cache.
+type engine[K comparable, V any] struct {
+	shards    []*shard[K, V]
+	shardMask uint64
+	loads     *loadGroup[K, V]
+	stats     *stats
+	janitor   *janitor
+	hasher    func(K) uint64
+	loader    func(context.Context, K) (V, time.Duration, error)
+	onEvict   func(K, V, EvictReason)
+	sizer     func(K, V) uint64
+	// expirationPolicy computes the expiration duration of the entries set with DefaultExpiration.
+	expirationPolicy func(K, V) time.Duration
+	// node identifies the cache in the invalidations it publishes, see WithInvalidator.
+	node        string
+	unsubscribe func()
+	// namespaces maps the names of the namespaces to their *namespace, see Namespace.
+	namespaces    sync.Map
+	hasNamespaces atomic.Bool
 	Options
 }
 
-// entrySize calculates the size of an entry based on the key and data
+// entrySize calculates the size of an entry based on the key and data,
+// including the memory used by the cache to index the entry.
 func entrySize[T any](key string, data T) uint64 {
-	keySize := uint64(len(key))
-	dataSize := uint64(size.Of(data))
-	totalSize := keySize + dataSize + 2*timeSize + uint64Size
-	return totalSize
+	return entryOverhead[string, T]() + uint64(len(key)) + uint64(size.Of(data))
+}
+
+// entryOverhead returns the memory used by an entry besides its key and data: the entry itself
+// without its inline data, its shard map slot, its eviction policy node and its expiry heap slot.
+func entryOverhead[K comparable, V any]() uint64 {
+	var entry CacheEntry[K, V]
+	return uint64(unsafe.Sizeof(entry)-unsafe.Sizeof(entry.data)) + 2*mapSlotSize + lruNodeSize + pointerSize
 }
 
 // New creates a new cache instance with the provided options.
+// It panics when the types of a generic option, e.g. WithOnEvict, do not match string keys and T values.
 func New[T any](options ...CacheOption) *Cache[T] {
+	o := newOptions(options)
+	c := new(Cache[T])
+	c.init(o, keyFromString, entrySize[T])
+	if o.invalidator != nil {
+		c.node = uuid.NewString()
+		c.unsubscribe = o.invalidator.Subscribe(c.node, c.invalidated)
+	}
+	if c.janitor != nil {
+		runtime.SetFinalizer(c, func(c *Cache[T]) {
+			c.Close()
+		})
+	}
+	return c
+}
+
+// newOptions applies the options over the defaults of the caches.
+func newOptions(options []CacheOption) Options {
 	o := Options{
-		capacity: defaultCapacity,
+		policy: NewLRUPolicy,
+		shards: 1,
+		codec:  GobCodec{},
+		clock:  SystemClock{},
+
+		defaultTTL: NoExpiration,
+
+		gcInterval: defaultGCInverval,
 	}
 	for _, option := range options {
 		option.apply(&o)
 	}
-	c := &Cache[T]{
-		items:  make(map[uint64]*CacheEntry[T]),
-		locker: new(sync.RWMutex),
-		size:   cacheMapSize,
-		lruList: &lruQueue{
-			mu: new(sync.Mutex),
-		},
-		Options: o,
+	if o.capacity == 0 {
+		o.capacity = defaultCapacity
+		if o.maxEntries > 0 {
+			o.capacity = math.MaxUint64
+		}
 	}
-	c.startGC(defaultGCInverval)
-	return c
+	return o
+}
+
+// init sets the engine up with the options and starts its garbage collection. Unless WithHasher and
+// WithSizer are given, the keys are hashed with hasher and the entries are sized with sizer.
+func (c *engine[K, V]) init(o Options, hasher func(K) uint64, sizer func(K, V) uint64) {
+	noShards := nextPowerOfTwo(max(o.shards, 1))
+	c.shards = make([]*shard[K, V], noShards)
+	c.shardMask = uint64(noShards - 1)
+	c.loads = newLoadGroup[K, V](o.clock)
+	c.stats = new(stats)
+	c.Options = o
+
+	c.hasher = hasher
+	if o.hasher != nil {
+		c.hasher = optionFunc[func(K) uint64]("WithHasher", o.hasher)
+	}
+	if o.loader != nil {
+		c.loader = optionFunc[func(context.Context, K) (V, time.Duration, error)]("WithLoader", o.loader)
+	}
+	if o.onEvict != nil {
+		c.onEvict = optionFunc[func(K, V, EvictReason)]("WithOnEvict", o.onEvict)
+	}
+	c.sizer = sizer
+	if o.sizer != nil {
+		c.sizer = optionFunc[func(K, V) uint64]("WithSizer", o.sizer)
+	}
+	if o.expirationPolicy != nil {
+		c.expirationPolicy = optionFunc[ExpirationPolicy[K, V]]("WithExpirationPolicy", o.expirationPolicy)
+	}
+	for i := range c.shards {
+		c.shards[i] = newShard[K, V](o.capacity/uint64(noShards), o.policy(), c.stats, c.onEvict)
+		if o.maxEntries > 0 {
+			c.shards[i].maxEntries = max((o.maxEntries+noShards-1)/noShards, 1)
+		}
+		if o.prefixIndex {
+			c.shards[i].prefixes = newPrefixTrie()
+		}
+	}
+	c.janitor = newJanitor(c.shards, c.loads, o.clock, o.gcInterval)
+}
+
+// shard returns the shard owning the hashed key.
+func (c *engine[K, V]) shard(hashKey uint64) *shard[K, V] {
+	return c.shards[hashKey&c.shardMask]
 }
 
 // Get retrieves the value associated with the given key from the cache.
-// If the key is not found or if the entry has expired, it returns the zero value of type T and false.
+// If the key is not found or if the entry has expired, it returns the zero value of type V and false.
 // Otherwise, it returns the value and true.
-func (c *Cache[T]) Get(key string) (T, bool) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-	hashKey := keyFromString(key)
-	entry, ok := c.items[hashKey]
-	if !ok || entry.exp.Before(time.Now()) {
-		delete(c.items, hashKey)
-		return zero[T](), false
+//
+// With a loader registered by WithLoader, an entry past its refresh point is still returned
+// while it is reloaded in the background.
+func (c *engine[K, V]) Get(key K) (V, bool) {
+	data, ok, refresh := c.get(key)
+	if ok {
+		c.stats.hits.Add(1)
+	} else {
+		c.stats.misses.Add(1)
+	}
+	c.lookedUp(key, ok)
+	if refresh {
+		c.refresh(key)
+	}
+	return data, ok
+}
+
+// get looks the key up and reports whether the entry is due for a refresh.
+func (c *engine[K, V]) get(key K) (data V, ok, refresh bool) {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	defer s.notify()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return c.lookup(s, hashKey, key, c.clock.Now())
+}
+
+// lookup returns the live value of the key and reports whether the entry is due for a refresh.
+// The caller must hold the shard lock.
+func (c *engine[K, V]) lookup(s *shard[K, V], hashKey uint64, key K, now time.Time) (data V, ok, refresh bool) {
+	entry := s.get(hashKey, key)
+	if entry == nil {
+		return zero[V](), false, false
+	}
+	if entry.expired(now) {
+		s.delete(hashKey, key, EvictExpired)
+		return zero[V](), false, false
 	}
 
-	c.lruList.moveToFront(key)
-	return entry.data, true
+	s.policy.Access(hashKey)
+	s.touch(entry)
+	if entry.ns != nil {
+		entry.ns.access(entry.hash)
+	}
+	if c.sliding && entry.ttl != NoExpiration {
+		// Only the deadline slides, a hot entry must still reach its refresh point.
+		deadline, _ := c.expiration(now, entry.ttl)
+		s.expire(entry, deadline, entry.refresh)
+	}
+	if !entry.refresh.IsZero() && !now.Before(entry.refresh) {
+		// Only the first hit past the refresh point triggers the reload.
+		entry.refresh = time.Time{}
+		refresh = true
+	}
+	return entry.data, true, refresh
 }
 
 // Set adds or updates a cache entry with the given key, data, and expiration duration.
-func (c *Cache[T]) Set(key string, data T, exp time.Duration) {
-	newSize := entrySize[T](key, data)
+// The entry never expires when exp is NoExpiration, and expires after the default TTL of the cache
+// when exp is DefaultExpiration.
+// Entries chosen by the eviction policy are evicted until the shard fits its capacity again;
+// an entry larger than the whole shard capacity is not kept at all.
+func (c *engine[K, V]) Set(key K, data V, exp time.Duration) {
+	c.set(c.newEntry(key, data, exp, c.sizer(key, data)))
+	c.publishKeys(key)
+}
 
-	c.incSize(newSize)
-	for c.size > c.capacity {
-		c.evictLRU()
-	}
+// SetWithCost is like Set but accounts the entry for the given cost instead of its size.
+func (c *engine[K, V]) SetWithCost(key K, data V, cost uint64, exp time.Duration) {
+	c.set(c.newEntry(key, data, exp, cost))
+	c.publishKeys(key)
+}
 
-	c.set(keyFromString(key), &CacheEntry[T]{
-		data: data,
-		exp:  time.Now().Add(exp),
-		size: newSize,
-	})
+func (c *engine[K, V]) set(entry *CacheEntry[K, V]) {
+	s := c.shard(entry.hash)
+	s.locker.Lock()
+	c.store(s, entry)
+	s.locker.Unlock()
+	s.notify()
+
+	c.enforceQuota(entry.ns)
 }
 
-// Filter applies a filter function to the cache entries and returns a slice of filtered values.
-func (c *Cache[T]) Filter(fn func(T) bool) []T {
-	snapshot := c.snapshot()
-	var result []T
-	for _, entry := range snapshot {
-		if fn(entry.data) {
-			result = append(result, entry.data)
+// store sets the entry in its shard and evicts entries until the shard is no longer full.
+// The caller must hold the shard lock.
+func (c *engine[K, V]) store(s *shard[K, V], entry *CacheEntry[K, V]) {
+	c.stats.sets.Add(1)
+	s.set(entry)
+	for s.full() {
+		if !s.evict() {
+			break
 		}
 	}
+}
+
+// Filter applies a filter function to the live cache entries and returns a slice of filtered values.
+func (c *engine[K, V]) Filter(fn func(V) bool) []V {
+	var result []V
+	c.Range(func(_ K, data V, _ time.Time) bool {
+		if fn(data) {
+			result = append(result, data)
+		}
+		return true
+	})
 	return result
 }
 
 // DeleteMatchingEntries deletes cache entries that match the given filter function.
-func (c *Cache[T]) DeleteMatchingEntries(fn func(T) bool) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	for key, entry := range c.items {
-		if fn(entry.data) {
-			delete(c.items, key)
+func (c *engine[K, V]) DeleteMatchingEntries(fn func(V) bool) {
+	var keys []K
+	for _, s := range c.shards {
+		s.locker.Lock()
+		for hashKey, head := range s.items {
+			for entry := head; entry != nil; entry = entry.next {
+				if fn(entry.data) {
+					s.delete(hashKey, entry.key, EvictDeleted)
+					keys = append(keys, entry.key)
+				}
+			}
 		}
+		s.locker.Unlock()
+		s.notify()
 	}
+	c.publishKeys(keys...)
 }
 
-// snapshot creates a snapshot of the cache items.
-func (c *Cache[T]) snapshot() map[uint64]*CacheEntry[T] {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	return maps.Clone(c.items)
+// Delete removes the data associated with a key
+func (c *engine[K, V]) Delete(key K) {
+	c.delete(key)
+	c.publishKeys(key)
 }
 
-func (c *Cache[T]) set(key uint64, entry *CacheEntry[T]) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
+func (c *engine[K, V]) delete(key K) {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	defer s.notify()
+	s.locker.Lock()
+	defer s.locker.Unlock()
 
-	c.items[key] = entry
+	s.delete(hashKey, key, EvictDeleted)
 }
 
-// incSize increments the size of the cache
-func (c *Cache[T]) incSize(size uint64) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	c.size += size
+// Prune removes every entry of the cache and resets its eviction policy.
+func (c *engine[K, V]) Prune() {
+	c.prune()
+	c.publish(Invalidation{Kind: InvalidationAll})
 }
 
-// Delete removes the data associated with a key
-func (c *Cache[T]) Delete(key string) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	delete(c.items, keyFromString(key))
-}
-
-func (c *Cache[T]) delete(hashKey uint64) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	delete(c.items, hashKey)
+func (c *engine[K, V]) prune() {
+	for _, s := range c.shards {
+		s.locker.Lock()
+		s.prune(c.policy(), c.hasNamespaces.Load())
+		s.locker.Unlock()
+		s.notify()
+	}
 }
 
-// Prune removes all cache's items
-func (c *Cache[T]) Prune(key string) {
-	c.locker.Lock()
-	defer c.locker.Unlock()
-
-	c.items = make(map[uint64]*CacheEntry[T])
-	c.size = cacheMapSize
+// optionFunc returns the value of a generic option, panicking when its type does not match the cache type.
+func optionFunc[F any](option string, value any) F {
+	fn, ok := value.(F)
+	if !ok {
+		panic(fmt.Sprintf("cache: %s value of type %T does not match the cache type", option, value))
+	}
+	return fn
 }
 
 // zero[T] returns the zero value of type T
@@ -185,8 +372,15 @@ func zero[T any]() T {
 	return z
 }
 
-func (c *Cache[T]) Size() uint64 {
-	return c.size
+// Size returns the sum of the shard sizes.
+func (c *engine[K, V]) Size() uint64 {
+	var total uint64
+	for _, s := range c.shards {
+		s.locker.RLock()
+		total += s.size
+		s.locker.RUnlock()
+	}
+	return total
 }
 
 func keyFromString(key string) (hashKey uint64) {
@@ -1,10 +1,21 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"expvar"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/google/uuid"
 )
@@ -40,3 +51,1194 @@ func BenchmarkCache(b *testing.B) {
 		wg.Wait()
 	}
 }
+
+// BenchmarkCacheParallel compares a single shard with several shards per core under parallel load.
+func BenchmarkCacheParallel(b *testing.B) {
+	keys := make([]string, 64*1000)
+	for i := range keys {
+		keys[i] = uuid.NewString()
+	}
+
+	for _, shards := range []int{1, 4 * runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := New[string](WithCapacity(100*1000*1000), WithShards(shards))
+			for _, key := range keys {
+				c.Set(key, dataSmall, time.Minute)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%10 == 0 {
+						c.Set(key, dataSmall, time.Minute)
+					} else {
+						c.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	entry := entrySize("a", "value")
+	c := New[string](WithCapacity(cacheMapSize + 3*entry))
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Minute)
+	c.Set("c", "value", time.Minute)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+
+	c.Set("d", "value", time.Minute)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is the least recently used entry and should have been evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+
+	c.Set("e", "value", time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a is the least recently used entry and should have been evicted")
+	}
+}
+
+func TestCacheCapacityHolds(t *testing.T) {
+	capacity := uint64(64 * 1000)
+	c := New[string](WithCapacity(capacity))
+
+	for i := 0; i < 10*1000; i++ {
+		key := fmt.Sprint(i % 500)
+		c.Set(key, dataSmall, time.Minute)
+		if c.Size() > capacity {
+			t.Fatalf("size %d exceeds capacity %d", c.Size(), capacity)
+		}
+	}
+
+	if len(c.shards[0].items) != c.shards[0].policy.(*lruQueue).len() {
+		t.Errorf("cache holds %d items but LRU tracks %d keys", len(c.shards[0].items), c.shards[0].policy.(*lruQueue).len())
+	}
+
+	var total uint64 = cacheMapSize
+	for _, entry := range c.shards[0].items {
+		total += entry.size
+	}
+	if total != c.Size() {
+		t.Errorf("size %d does not match the sum of entries %d", c.Size(), total)
+	}
+}
+
+func TestCacheDeleteReleasesSize(t *testing.T) {
+	c := New[string]()
+	c.Set("a", dataSmall, time.Minute)
+	c.Set("a", dataSmall, time.Minute)
+	c.Delete("a")
+
+	if c.Size() != cacheMapSize {
+		t.Errorf("size = %d, want %d", c.Size(), cacheMapSize)
+	}
+	if c.shards[0].policy.(*lruQueue).len() != 0 {
+		t.Errorf("LRU still tracks %d keys", c.shards[0].policy.(*lruQueue).len())
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	capacity := uint64(256 * 1000)
+	c := New[string](WithCapacity(capacity), WithShards(3))
+	if len(c.shards) != 4 {
+		t.Fatalf("got %d shards, want 4", len(c.shards))
+	}
+
+	for i := 0; i < 10*1000; i++ {
+		c.Set(fmt.Sprint(i), dataSmall, time.Minute)
+	}
+	for i, s := range c.shards {
+		if s.size > capacity/4 {
+			t.Errorf("shard %d size %d exceeds its capacity %d", i, s.size, capacity/4)
+		}
+		if len(s.items) == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+	}
+
+	c.Set("key", "value", time.Minute)
+	if v, ok := c.Get("key"); !ok || v != "value" {
+		t.Errorf("Get() = %q, %v", v, ok)
+	}
+	c.Delete("key")
+	if _, ok := c.Get("key"); ok {
+		t.Error("key should have been deleted")
+	}
+}
+
+func TestCacheHashCollisions(t *testing.T) {
+	c := New[string]()
+	s := c.shards[0]
+	const hashKey = 42
+
+	for _, key := range []string{"a", "b", "c"} {
+		s.set(&CacheEntry[string, string]{key: key, hash: hashKey, data: "value of " + key, exp: time.Now().Add(time.Minute), size: 1})
+	}
+	s.set(&CacheEntry[string, string]{key: "b", hash: hashKey, data: "new value of b", exp: time.Now().Add(time.Minute), size: 1})
+
+	for key, want := range map[string]string{"a": "value of a", "b": "new value of b", "c": "value of c"} {
+		entry := s.get(hashKey, key)
+		if entry == nil || entry.data != want {
+			t.Errorf("get(%q) = %v, want %q", key, entry, want)
+		}
+	}
+	if s.get(hashKey, "d") != nil {
+		t.Error("d shares the hash but was never set")
+	}
+	if s.size != cacheMapSize+3 {
+		t.Errorf("size = %d, want %d", s.size, cacheMapSize+3)
+	}
+
+	s.delete(hashKey, "b", EvictDeleted)
+	if s.get(hashKey, "b") != nil || s.get(hashKey, "a") == nil || s.get(hashKey, "c") == nil {
+		t.Error("deleting b should only remove b from the chain")
+	}
+
+	if !s.evict() {
+		t.Fatal("evict() should evict the chain")
+	}
+	if len(s.items) != 0 || s.size != cacheMapSize {
+		t.Errorf("evicting the chain left %d items and size %d", len(s.items), s.size)
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	c := New[string]()
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (string, time.Duration, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return "value", time.Minute, nil
+	}
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := c.GetOrLoad(context.Background(), "key", loader)
+			if err != nil || data != "value" {
+				t.Errorf("GetOrLoad() = %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	if data, ok := c.Get("key"); !ok || data != "value" {
+		t.Errorf("Get() = %q, %v after load", data, ok)
+	}
+}
+
+func TestCacheGetOrLoadErrors(t *testing.T) {
+	errBackend := errors.New("backend down")
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (string, time.Duration, error) {
+		calls.Add(1)
+		return "", 0, errBackend
+	}
+
+	c := New[string]()
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetOrLoad(context.Background(), "key", loader); !errors.Is(err, errBackend) {
+			t.Errorf("GetOrLoad() error = %v, want %v", err, errBackend)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("loader called %d times without negative caching, want 2", n)
+	}
+
+	calls.Store(0)
+	c = New[string](WithNegativeTTL(time.Minute))
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad(context.Background(), "key", loader); !errors.Is(err, errBackend) {
+			t.Errorf("GetOrLoad() error = %v, want %v", err, errBackend)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %d times with negative caching, want 1", n)
+	}
+}
+
+func TestCacheGetOrLoadPanic(t *testing.T) {
+	c := New[string]()
+	for i := 0; i < 2; i++ {
+		_, err := c.GetOrLoad(context.Background(), "key", func(context.Context) (string, time.Duration, error) {
+			panic("boom")
+		})
+		if !errors.Is(err, ErrLoaderPanic) || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("GetOrLoad() error = %v, want the panic as %v", err, ErrLoaderPanic)
+		}
+	}
+
+	data, err := c.GetOrLoad(context.Background(), "key", func(context.Context) (string, time.Duration, error) {
+		return "value", time.Minute, nil
+	})
+	if err != nil || data != "value" {
+		t.Errorf("GetOrLoad() = %q, %v after a panicking load", data, err)
+	}
+}
+
+func TestCacheNegativeTTLBounded(t *testing.T) {
+	errMissing := errors.New("missing")
+	fail := func(context.Context) (string, time.Duration, error) {
+		return "", 0, errMissing
+	}
+	c := New[string](WithNegativeTTL(time.Minute), WithoutGC())
+
+	// Lookups of distinct missing keys must not grow the remembered failures without bound.
+	for i := 0; i < 2*maxNegatives; i++ {
+		c.GetOrLoad(context.Background(), fmt.Sprint(i), fail)
+	}
+	c.loads.mu.Lock()
+	n := len(c.loads.negatives)
+	c.loads.mu.Unlock()
+	if n == 0 || n > maxNegatives {
+		t.Errorf("%d failures remembered, want at most %d", n, maxNegatives)
+	}
+
+	c.loads.collectGarbage(time.Now().Add(time.Minute))
+	if len(c.loads.negatives) != 0 {
+		t.Errorf("%d expired failures left after the garbage collection", len(c.loads.negatives))
+	}
+}
+
+func TestCacheGetOrLoadCanceled(t *testing.T) {
+	c := New[string]()
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, time.Duration, error) {
+		<-release
+		return "value", time.Minute, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetOrLoad(ctx, "key", loader); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	if data, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || data != "value" {
+		t.Errorf("GetOrLoad() = %q, %v, the load should survive the canceled caller", data, err)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheOptionMismatch(t *testing.T) {
+	for name, option := range map[string]CacheOption{
+		"WithLoader": WithLoader(func(context.Context, string) (int, time.Duration, error) {
+			return 0, 0, nil
+		}),
+		"WithOnEvict":          WithOnEvict(func(int, string, EvictReason) {}),
+		"WithSizer":            WithSizer(func(string, []byte) uint64 { return 0 }),
+		"WithHasher":           WithHasher(func(int) uint64 { return 0 }),
+		"WithExpirationPolicy": WithExpirationPolicy(func(string, int) time.Duration { return 0 }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of other types than string keys and values should panic", name)
+				}
+			}()
+			New[string](option)
+		})
+	}
+}
+
+func TestCacheOnEvict(t *testing.T) {
+	type event struct {
+		key    string
+		reason EvictReason
+	}
+	var events []event
+	var c *Cache[string]
+	onEvict := func(key string, value string, reason EvictReason) {
+		events = append(events, event{key, reason})
+		// The callback runs outside the lock and may use the cache.
+		c.Get(key)
+	}
+
+	entry := entrySize("a", "value")
+	c = New[string](WithCapacity(cacheMapSize+2*entry), WithOnEvict(onEvict))
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Minute)
+	c.Set("c", "value", time.Minute)
+	c.Set("c", "other", time.Minute)
+	c.Delete("c")
+	c.Set("d", "value", -time.Second)
+	c.Get("d")
+	c.Set("e", "value", -time.Second)
+	c.collectGarbage()
+	c.Set("f", "match", time.Minute)
+	c.DeleteMatchingEntries(func(v string) bool { return v == "match" })
+	c.Set("g", "value", time.Minute)
+	c.Prune()
+
+	want := []event{
+		{"a", EvictCapacity},
+		{"c", EvictReplaced},
+		{"c", EvictDeleted},
+		{"d", EvictExpired},
+		{"e", EvictExpired},
+		{"f", EvictDeleted},
+	}
+	if len(events) != len(want)+2 || fmt.Sprint(events[:len(want)]) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v followed by b and g pruned", events, want)
+	}
+	for _, e := range events[len(want):] {
+		if (e.key != "b" && e.key != "g") || e.reason != EvictPruned {
+			t.Errorf("got %v, want b and g pruned", e)
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	entry := entrySize("a", "value")
+	c := New[string](WithCapacity(cacheMapSize + 2*entry))
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Minute)
+	c.Set("c", "value", time.Minute)
+	c.Get("b")
+	c.Get("c")
+	c.Get("a")
+	c.Delete("b")
+	c.GetOrLoad(context.Background(), "d", func(ctx context.Context) (string, time.Duration, error) {
+		return "", 0, errors.New("failed")
+	})
+
+	want := Stats{
+		Hits:         2,
+		Misses:       2,
+		Sets:         3,
+		Evictions:    1,
+		Deletions:    1,
+		LoadFailures: 1,
+		HitRatio:     0.5,
+		Entries:      1,
+		Size:         cacheMapSize + entry,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// expvar names are global, each run of the test needs its own.
+	name := "TestCacheStats-" + uuid.NewString()
+	c.PublishExpvar(name)
+	if v := expvar.Get(name).String(); !strings.Contains(v, `"Hits":2`) {
+		t.Errorf("expvar = %s", v)
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		t.Run(fmt.Sprintf("%T", codec), func(t *testing.T) {
+			entry := entrySize("a", "value")
+			c := New[string](WithCodec(codec))
+			c.Set("a", "value", time.Minute)
+			c.Set("b", "value", time.Minute)
+			c.Set("c", "value", time.Minute)
+			c.Set("expired", "value", -time.Second)
+			c.Get("a")
+
+			fp := filepath.Join(t.TempDir(), "cache.snapshot")
+			if err := c.SaveToFile(fp); err != nil {
+				t.Fatalf("SaveToFile() error = %v", err)
+			}
+
+			restored := New[string](WithCapacity(cacheMapSize+3*entry), WithCodec(codec))
+			if err := restored.LoadFromFile(fp); err != nil {
+				t.Fatalf("LoadFromFile() error = %v", err)
+			}
+			if _, ok := restored.Get("expired"); ok {
+				t.Error("expired entries should not be restored")
+			}
+			if n := restored.Stats().Entries; n != 3 {
+				t.Errorf("restored %d entries, want 3", n)
+			}
+
+			// b is the least recently used entry of the snapshot.
+			restored.Set("d", "value", time.Minute)
+			if _, ok := restored.Get("b"); ok {
+				t.Error("b should have been evicted first")
+			}
+			for _, key := range []string{"a", "c", "d"} {
+				if data, ok := restored.Get(key); !ok || data != "value" {
+					t.Errorf("Get(%q) = %q, %v", key, data, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheLoadFromInvalidSnapshot(t *testing.T) {
+	c := New[string]()
+	if err := c.LoadFrom(strings.NewReader("not a snapshot")); !errors.Is(err, ErrSnapshotFormat) {
+		t.Errorf("LoadFrom() error = %v, want %v", err, ErrSnapshotFormat)
+	}
+
+	var buffer bytes.Buffer
+	c.SaveTo(&buffer)
+	data := buffer.Bytes()
+	data[len(snapshotMagic)]++
+	if err := c.LoadFrom(bytes.NewReader(data)); !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("LoadFrom() error = %v, want %v", err, ErrSnapshotVersion)
+	}
+	data[len(snapshotMagic)] = 1
+	if err := c.LoadFrom(bytes.NewReader(data)); err != nil {
+		t.Errorf("LoadFrom() error = %v, version 1 snapshots should still load", err)
+	}
+	data[len(snapshotMagic)] = snapshotVersion
+
+	c.Set("key", "value", time.Minute)
+	buffer.Reset()
+	c.SaveTo(&buffer)
+	valid := buffer.Bytes()
+	header := len(data)
+	for name, corrupt := range map[string][]byte{
+		"truncated entry":  valid[:len(valid)-1],
+		"truncated length": append(slices.Clone(valid[:header]), 0x80),
+		"huge length":      binary.AppendUvarint(slices.Clone(valid[:header]), 1<<62),
+	} {
+		if err := New[string]().LoadFrom(bytes.NewReader(corrupt)); !errors.Is(err, ErrSnapshotFormat) {
+			t.Errorf("LoadFrom(%s) error = %v, want %v", name, err, ErrSnapshotFormat)
+		}
+	}
+}
+
+func TestCacheClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	caches := make([]*Cache[string], 10)
+	for i := range caches {
+		caches[i] = New[string](WithGCInterval(time.Millisecond))
+	}
+	for _, c := range caches {
+		c.Close()
+		c.Close()
+	}
+	waitFor(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	})
+
+	c := New[string](WithoutGC())
+	if c.janitor != nil {
+		t.Error("WithoutGC() should not start the garbage collector")
+	}
+	c.Close()
+}
+
+func TestCacheExpiryHeap(t *testing.T) {
+	c := New[string](WithoutGC())
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprint(i % 300)
+		c.Set(key, "value", time.Duration(i%17)*time.Minute)
+		if i%5 == 0 {
+			c.Delete(fmt.Sprint(i % 7))
+		}
+	}
+
+	s := c.shards[0]
+	if len(s.expiries) != s.count {
+		t.Fatalf("heap holds %d entries, shard %d", len(s.expiries), s.count)
+	}
+	for i, entry := range s.expiries {
+		if entry.index != i {
+			t.Fatalf("entry %q has index %d at position %d", entry.key, entry.index, i)
+		}
+		if parent := (i - 1) / 2; i > 0 && entry.exp.Before(s.expiries[parent].exp) {
+			t.Fatalf("entry %q expires before its parent", entry.key)
+		}
+	}
+}
+
+func TestCacheHeapUsage(t *testing.T) {
+	const capacity = 16 * 1000 * 1000
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	c := New[string](WithCapacity(capacity), WithoutGC())
+	for i := 0; i < 100*1000; i++ {
+		value := strings.Repeat(fmt.Sprint(i%10), 1000)
+		c.Set(uuid.NewString(), value, time.Minute)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	used := float64(after.HeapAlloc) - float64(before.HeapAlloc)
+	t.Logf("capacity %d, size %d, heap growth %.0f", capacity, c.Size(), used)
+	if used > 1.25*capacity || used < 0.75*capacity {
+		t.Errorf("heap grew by %.0f bytes for a capacity of %d", used, capacity)
+	}
+	runtime.KeepAlive(c)
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := New[string](WithMaxEntries(100), WithShards(4))
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), dataSmall, time.Minute)
+	}
+	if n := c.Stats().Entries; n > 100 {
+		t.Errorf("cache holds %d entries, want at most 100", n)
+	}
+}
+
+func TestCacheSizer(t *testing.T) {
+	c := New[string](WithCapacity(cacheMapSize+10), WithSizer(func(key string, value string) uint64 {
+		return uint64(len(value))
+	}))
+	c.Set("a", "12345", time.Minute)
+	c.Set("b", "12345", time.Minute)
+	if c.Size() != cacheMapSize+10 {
+		t.Errorf("size = %d, want %d", c.Size(), cacheMapSize+10)
+	}
+
+	c.SetWithCost("c", "12345", 7, time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should have been evicted to make room for c")
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted to make room for c")
+	}
+	if c.Size() != cacheMapSize+7 {
+		t.Errorf("size = %d, want %d", c.Size(), cacheMapSize+7)
+	}
+}
+
+func TestCacheIteration(t *testing.T) {
+	c := New[string](WithShards(4))
+	want := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		c.Set(key, "value "+key, time.Minute)
+		want[key] = "value " + key
+	}
+	c.Set("expired", "value", -time.Second)
+
+	if n := c.Len(); n != 101 {
+		t.Errorf("Len() = %d, want 101", n)
+	}
+	if keys := c.Keys(); len(keys) != 100 {
+		t.Errorf("Keys() returned %d keys, want 100", len(keys))
+	}
+
+	got := make(map[string]string)
+	for key, value := range c.All() {
+		got[key] = value
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	n := 0
+	c.Range(func(key string, value string, exp time.Time) bool {
+		if exp.Before(time.Now()) {
+			t.Errorf("Range() yielded the expired entry %q", key)
+		}
+		// Range runs without the lock, fn may use the cache.
+		c.Delete(key)
+		n++
+		return n < 10
+	})
+	if n != 10 || c.Len() != 91 {
+		t.Errorf("Range() visited %d entries and left %d, want 10 and 91", n, c.Len())
+	}
+}
+
+func TestCacheRangeBounded(t *testing.T) {
+	const n = 20 * rangeChunk
+	c := New[string](WithoutGC(), WithMaxEntries(4*n))
+	for i := 0; i < n; i++ {
+		c.Set(fmt.Sprint(i), "value", time.Minute)
+	}
+
+	// Stopping at the first entry only copies the first chunk of the shard, not the whole cache.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		c.Range(func(string, string, time.Time) bool {
+			return false
+		})
+	}
+	runtime.ReadMemStats(&after)
+	limit := 2 * rangeChunk * uint64(unsafe.Sizeof(item[string, string]{}))
+	if allocated := (after.TotalAlloc - before.TotalAlloc) / 10; allocated > limit {
+		t.Errorf("Range() allocated %d bytes to stop at the first entry, want at most %d", allocated, limit)
+	}
+
+	// The iteration resumes between chunks while fn changes the cache, visiting each entry at most once.
+	seen := make(map[string]bool)
+	c.Range(func(key, _ string, _ time.Time) bool {
+		if seen[key] {
+			t.Fatalf("Range() visited %q twice", key)
+		}
+		seen[key] = true
+		c.Delete(key)
+		c.Set("new "+key, "value", time.Minute)
+		return true
+	})
+	for i := 0; i < n; i++ {
+		if !seen[fmt.Sprint(i)] {
+			t.Fatalf("Range() did not visit %d", i)
+		}
+	}
+}
+
+func TestCacheEntryMetadata(t *testing.T) {
+	entry := entrySize("a", "value")
+	c := New[string](WithCapacity(cacheMapSize + 2*entry))
+
+	c.Set("a", "value", time.Minute)
+	c.SetNoExpire("b", "value")
+	if data, ok := c.Peek("a"); !ok || data != "value" {
+		t.Errorf("Peek() = %q, %v", data, ok)
+	}
+	// Peek does not refresh a, which stays the least recently used entry.
+	c.Get("b")
+	c.Set("c", "value", time.Minute)
+	if _, ok := c.Peek("a"); ok {
+		t.Error("a should have been evicted, Peek must not count as an access")
+	}
+	if st := c.Stats(); st.Hits != 1 || st.Misses != 0 {
+		t.Errorf("Peek() should not be counted, got %d hits and %d misses", st.Hits, st.Misses)
+	}
+
+	if ttl, ok := c.TTL("b"); !ok || ttl != NoExpiration {
+		t.Errorf("TTL(b) = %v, %v, want NoExpiration", ttl, ok)
+	}
+	if ttl, ok := c.TTL("c"); !ok || ttl <= 59*time.Second || ttl > time.Minute {
+		t.Errorf("TTL(c) = %v, %v, want about a minute", ttl, ok)
+	}
+	if _, ok := c.TTL("a"); ok {
+		t.Error("TTL(a) should report a missing key")
+	}
+
+	if !c.Touch("c", time.Hour) {
+		t.Error("Touch(c) should find the key")
+	}
+	if ttl, _ := c.TTL("c"); ttl <= 59*time.Minute {
+		t.Errorf("TTL(c) = %v after Touch, want about an hour", ttl)
+	}
+	if !c.Touch("b", -time.Second) {
+		t.Error("Touch(b) should find the key")
+	}
+	c.collectGarbage()
+	if _, ok := c.Peek("b"); ok || c.Len() != 1 {
+		t.Error("b should have expired after Touch")
+	}
+	if c.Touch("missing", time.Minute) {
+		t.Error("Touch(missing) should report a missing key")
+	}
+}
+
+func TestCacheConditionalSets(t *testing.T) {
+	c := New[string]()
+	if !c.SetIfAbsent("token", "first", time.Minute) {
+		t.Error("SetIfAbsent() should set a missing key")
+	}
+	if c.SetIfAbsent("token", "second", time.Minute) {
+		t.Error("SetIfAbsent() should not overwrite an existing key")
+	}
+	if data, _ := c.Get("token"); data != "first" {
+		t.Errorf("Get() = %q, want first", data)
+	}
+
+	if c.Replace("missing", "value", time.Minute) {
+		t.Error("Replace() should not set a missing key")
+	}
+	if !c.Replace("token", "replaced", time.Minute) {
+		t.Error("Replace() should overwrite an existing key")
+	}
+
+	c.Set("expired", "value", -time.Second)
+	if !c.SetIfAbsent("expired", "value", time.Minute) {
+		t.Error("SetIfAbsent() should treat an expired key as missing")
+	}
+}
+
+func TestCacheCompareAndSwap(t *testing.T) {
+	c := New[[]string]()
+	c.Set("list", []string{"a"}, time.Hour)
+
+	if c.CompareAndSwap("list", []string{"b"}, []string{"c"}, nil) {
+		t.Error("CompareAndSwap() should fail when the value differs")
+	}
+	if !c.CompareAndSwap("list", []string{"a"}, []string{"a", "b"}, nil) {
+		t.Error("CompareAndSwap() should swap equal values")
+	}
+	sameLength := func(a, b []string) bool { return len(a) == len(b) }
+	if !c.CompareAndSwap("list", []string{"x", "y"}, []string{"z"}, sameLength) {
+		t.Error("CompareAndSwap() should use the equality function")
+	}
+	if data, _ := c.Get("list"); fmt.Sprint(data) != "[z]" {
+		t.Errorf("Get() = %v, want [z]", data)
+	}
+	if ttl, _ := c.TTL("list"); ttl <= 59*time.Minute {
+		t.Errorf("TTL() = %v, CompareAndSwap should keep the expiration", ttl)
+	}
+	if c.CompareAndSwap("missing", nil, []string{"a"}, nil) {
+		t.Error("CompareAndSwap() should fail on a missing key")
+	}
+}
+
+func TestCacheUpdate(t *testing.T) {
+	c := New[int](WithShards(4))
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Increment(c, "counter", 2)
+				Decrement(c, "counter", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if data, _ := c.Get("counter"); data != 5000 {
+		t.Errorf("counter = %d, want 5000", data)
+	}
+
+	if c.Update("counter", func(old int, ok bool) (int, bool) { return 0, false }) {
+		t.Error("Update() should report that nothing was stored")
+	}
+	if data, _ := c.Get("counter"); data != 5000 {
+		t.Errorf("counter = %d, Update returning false should leave it unchanged", data)
+	}
+	if ttl, _ := c.TTL("counter"); ttl != NoExpiration {
+		t.Errorf("TTL() = %v, counters created by Increment should not expire without a default TTL", ttl)
+	}
+}
+
+func TestCacheBatch(t *testing.T) {
+	c := New[string](WithShards(4))
+	items := make(map[string]string)
+	keys := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		items[key] = "value " + key
+		keys = append(keys, key)
+	}
+
+	c.SetMany(items, time.Minute)
+	if n := c.Len(); n != 100 {
+		t.Fatalf("Len() = %d after SetMany, want 100", n)
+	}
+	var total uint64 = 4 * cacheMapSize
+	for key, value := range items {
+		total += entrySize(key, value)
+	}
+	if c.Size() != total {
+		t.Errorf("Size() = %d, want %d", c.Size(), total)
+	}
+
+	got := c.GetMany(append(keys, "missing"))
+	if fmt.Sprint(got) != fmt.Sprint(items) {
+		t.Errorf("GetMany() = %v, want %v", got, items)
+	}
+	if st := c.Stats(); st.Hits != 100 || st.Misses != 1 || st.Sets != 100 {
+		t.Errorf("Stats() = %+v", st)
+	}
+
+	c.DeleteMany(keys[:50])
+	if n := c.Len(); n != 50 {
+		t.Errorf("Len() = %d after DeleteMany, want 50", n)
+	}
+	if _, ok := c.Get(keys[0]); ok {
+		t.Errorf("%s should have been deleted", keys[0])
+	}
+}
+
+func BenchmarkCacheBatch(b *testing.B) {
+	keys := make([]string, 100)
+	items := make(map[string]string, len(keys))
+	for i := range keys {
+		keys[i] = uuid.NewString()
+		items[keys[i]] = dataSmall
+	}
+	c := New[string](WithShards(16))
+	c.SetMany(items, time.Hour)
+
+	b.Run("GetMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.GetMany(keys)
+		}
+	})
+	b.Run("GetLoop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			result := make(map[string]string, len(keys))
+			for _, key := range keys {
+				if data, ok := c.Get(key); ok {
+					result[key] = data
+				}
+			}
+		}
+	})
+	b.Run("SetMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.SetMany(items, time.Hour)
+		}
+	})
+	b.Run("SetLoop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for key, data := range items {
+				c.Set(key, data, time.Hour)
+			}
+		}
+	})
+}
+
+func TestCacheTags(t *testing.T) {
+	c := New[string](WithShards(4))
+	empty := c.Size()
+	c.SetWithTags("user:42:profile", "profile", time.Minute, "user:42")
+	c.SetWithTags("user:42:orders", "orders", time.Minute, "user:42", "orders", "user:42")
+	c.SetWithTags("user:7:orders", "orders", time.Minute, "user:7", "orders")
+	c.Set("config", "config", NoExpiration)
+
+	want := empty + entrySize("config", "config") + entrySize("user:7:orders", "orders") + tagsSize([]string{"orders", "user:7"})
+
+	c.InvalidateTag("user:42")
+	if n := c.Len(); n != 2 {
+		t.Fatalf("Len() = %d after InvalidateTag, want 2", n)
+	}
+	if _, ok := c.Get("user:42:orders"); ok {
+		t.Error("user:42:orders should have been invalidated")
+	}
+	if c.Size() != want {
+		t.Errorf("Size() = %d, want %d", c.Size(), want)
+	}
+
+	// Replacing a tagged entry drops its tags.
+	c.Set("user:7:orders", "replaced", time.Minute)
+	c.InvalidateTag("orders")
+	if _, ok := c.Get("user:7:orders"); !ok {
+		t.Error("user:7:orders should have kept its untagged value")
+	}
+	c.InvalidateTag("missing")
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+
+	c.SetWithTags("a", "a", time.Minute, "letters")
+	c.Delete("a")
+	for _, s := range c.shards {
+		if len(s.tags) != 0 {
+			t.Errorf("tag index not cleaned up: %v", s.tags)
+		}
+	}
+}
+
+func TestCacheDeleteByPrefix(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprint("indexed=", indexed), func(t *testing.T) {
+			options := []CacheOption{WithShards(4)}
+			if indexed {
+				options = append(options, WithPrefixIndex())
+			}
+			c := New[int](options...)
+			empty := c.Size()
+			for i := 0; i < 100; i++ {
+				c.Set(fmt.Sprintf("user:%d", i), i, time.Minute)
+			}
+			c.Set("use", 0, time.Minute)
+			c.Set("session:1", 1, time.Minute)
+
+			c.DeleteByPrefix("user:1")
+			if n := c.Len(); n != 100-11+2 {
+				t.Errorf("Len() = %d after deleting user:1, want %d", n, 100-11+2)
+			}
+			if _, ok := c.Get("user:10"); ok {
+				t.Error("user:10 should have been deleted")
+			}
+			if _, ok := c.Get("user:2"); !ok {
+				t.Error("user:2 should not have been deleted")
+			}
+
+			c.DeleteByPrefix("user:")
+			if keys := c.Keys(); len(keys) != 2 {
+				t.Errorf("Keys() = %v, want use and session:1", keys)
+			}
+			c.DeleteByPrefix("")
+			if c.Len() != 0 || c.Size() != empty {
+				t.Errorf("Len() = %d, Size() = %d after deleting everything, want 0 and %d", c.Len(), c.Size(), empty)
+			}
+			if indexed {
+				for _, s := range c.shards {
+					if len(s.prefixes.root.children) != 0 || s.prefixes.root.count != 0 {
+						t.Error("prefix index not cleaned up")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotTags(t *testing.T) {
+	src := New[string]()
+	src.SetWithTags("a", "a", time.Hour, "letters")
+	var buf bytes.Buffer
+	if err := src.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := New[string]()
+	if err := dst.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst.InvalidateTag("letters")
+	if dst.Len() != 0 {
+		t.Error("tags should be restored from the snapshot")
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	c := New[string](WithShards(2))
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprint(i), "value", time.Minute)
+	}
+
+	c.Prune()
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len() = %d after Prune, want 0", n)
+	}
+	for _, s := range c.shards {
+		if hashKey, ok := s.policy.Evict(); ok {
+			t.Errorf("the eviction policy still tracks %d after Prune", hashKey)
+		}
+	}
+	if st := c.Stats(); st.Prunes != 10 {
+		t.Errorf("%d prunes, want 10", st.Prunes)
+	}
+}
+
+func TestCacheNamespace(t *testing.T) {
+	c := New[string](WithShards(4))
+	users := c.Namespace("users")
+	orders := c.Namespace("orders")
+
+	users.Set("1", "alice", time.Minute)
+	orders.Set("1", "book", time.Minute)
+	if data, ok := c.Get("users:1"); !ok || data != "alice" {
+		t.Errorf(`Get("users:1") = %q, %v, want alice`, data, ok)
+	}
+	if data, ok := orders.Get("1"); !ok || data != "book" {
+		t.Errorf("orders.Get() = %q, %v, want book", data, ok)
+	}
+	users.Get("2")
+
+	st := users.Stats()
+	if st.Hits != 1 || st.Misses != 1 || st.Sets != 1 || st.Entries != 1 || st.Size != entrySize("users:1", "alice") {
+		t.Errorf("users.Stats() = %+v", st)
+	}
+
+	c.Set("orders:2", "pen", time.Minute)
+	if n := c.Namespace("orders").Stats().Entries; n != 2 {
+		t.Errorf("%d orders, entries set through the cache should be accounted", n)
+	}
+	c.PruneNamespace("orders")
+	if _, ok := c.Get("users:1"); !ok {
+		t.Error("pruning orders should not remove users")
+	}
+	if st := orders.Stats(); st.Entries != 0 || st.Size != 0 || st.Prunes != 2 {
+		t.Errorf("orders.Stats() = %+v after PruneNamespace", st)
+	}
+
+	c.Prune()
+	if st := users.Stats(); st.Entries != 0 || st.Size != 0 {
+		t.Errorf("users.Stats() = %+v after Prune", st)
+	}
+}
+
+func TestCacheNamespaceQuota(t *testing.T) {
+	c := New[string](WithShards(4))
+	size := entrySize("small:00", "value")
+	small := c.Namespace("small", WithQuota(10*size))
+	large := c.Namespace("large")
+
+	for i := 0; i < 20; i++ {
+		small.Set(fmt.Sprintf("%02d", i), "value", time.Minute)
+		large.Set(fmt.Sprintf("%02d", i), "value", time.Minute)
+		if i == 15 {
+			small.Get("06")
+		}
+	}
+
+	if st := small.Stats(); st.Entries != 10 || st.Size > 10*size || st.Evictions != 10 {
+		t.Errorf("small.Stats() = %+v, want 10 entries within the quota", st)
+	}
+	if _, ok := small.Get("06"); !ok {
+		t.Error("the recently used 06 should not have been evicted")
+	}
+	if _, ok := small.Get("07"); ok {
+		t.Error("the least recently used 07 should have been evicted")
+	}
+	if n := large.Stats().Entries; n != 20 {
+		t.Errorf("%d large entries, the quota of small should not evict them", n)
+	}
+
+	c.Namespace("small", WithQuota(5*size))
+	if n := small.Stats().Entries; n != 5 {
+		t.Errorf("%d small entries after lowering the quota, want 5", n)
+	}
+
+	// Replacing the value of an entry keeps it in its namespace.
+	if !c.CompareAndSwap("small:19", "value", "other", nil) {
+		t.Fatal("CompareAndSwap(small:19) should swap the value")
+	}
+	c.Update("small:18", func(string, bool) (string, bool) {
+		return "VALUE", true
+	})
+	if st := small.Stats(); st.Entries != 5 || st.Size > 5*size {
+		t.Errorf("small.Stats() = %+v after CompareAndSwap and Update, want 5 entries", st)
+	}
+	small.Set("20", "value", time.Minute)
+	if n := small.Stats().Entries; n != 5 {
+		t.Errorf("%d small entries, the quota should still bound the replaced entries", n)
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	type point struct{ X, Y int }
+	var calls atomic.Int32
+	distance := Memoize(func(_ context.Context, p point) (int, error) {
+		calls.Add(1)
+		return p.X*p.X + p.Y*p.Y, nil
+	}, WithTTL(time.Minute))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if d, err := distance(ctx, point{3, 4}); err != nil || d != 25 {
+			t.Errorf("distance() = %d, %v, want 25", d, err)
+		}
+	}
+	if d, _ := distance(ctx, point{4, 3}); d != 25 || calls.Load() != 2 {
+		t.Errorf("distance() = %d with %d calls, want 25 with 2 calls", d, calls.Load())
+	}
+
+	// Arguments with the same key share their results.
+	calls.Store(0)
+	length := Memoize(func(_ context.Context, s string) (int, error) {
+		calls.Add(1)
+		return len(s), nil
+	}, WithKeyFunc(strings.ToLower))
+	length(ctx, "Hello")
+	if n, _ := length(ctx, "HELLO"); n != 5 || calls.Load() != 1 {
+		t.Errorf("length() = %d with %d calls, want 5 with 1 call", n, calls.Load())
+	}
+
+	// Values of different types held by an interface do not share their results.
+	describe := Memoize(func(_ context.Context, v any) (string, error) {
+		return fmt.Sprintf("%T", v), nil
+	})
+	for _, arg := range []any{1, "1", int64(1), "1", 1} {
+		if got, _ := describe(ctx, arg); got != fmt.Sprintf("%T", arg) {
+			t.Errorf("describe(%#v) = %s, want %T", arg, got, arg)
+		}
+	}
+	// Nor do arguments printed alike.
+	type wrapper struct{ V any }
+	wrapped := Memoize(func(_ context.Context, w wrapper) (string, error) {
+		return fmt.Sprintf("%T", w.V), nil
+	})
+	for _, arg := range []wrapper{{V: 1}, {V: int64(1)}, {V: 1}} {
+		if got, _ := wrapped(ctx, arg); got != fmt.Sprintf("%T", arg.V) {
+			t.Errorf("wrapped(%#v) = %s, want %T", arg, got, arg.V)
+		}
+	}
+}
+
+func TestMemoizeSingleflight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := Memoize(func(_ context.Context, n int) (int, error) {
+		calls.Add(1)
+		<-release
+		return n * 2, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, err := slow(context.Background(), 21); err != nil || n != 42 {
+				t.Errorf("slow() = %d, %v, want 42", n, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want concurrent misses to share one", calls.Load())
+	}
+}
+
+func TestMemoizeErrors(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errNotFound := errors.New("not found")
+	var calls atomic.Int32
+	lookup := Memoize(func(_ context.Context, key string) (string, error) {
+		calls.Add(1)
+		if key == "missing" {
+			return "", errNotFound
+		}
+		return "", errTemporary
+	}, WithErrorPolicy(func(err error) time.Duration {
+		if errors.Is(err, errNotFound) {
+			return time.Minute
+		}
+		return 0
+	}))
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := lookup(ctx, "missing"); !errors.Is(err, errNotFound) {
+			t.Errorf("lookup(missing) error = %v, want %v", err, errNotFound)
+		}
+		if _, err := lookup(ctx, "flaky"); !errors.Is(err, errTemporary) {
+			t.Errorf("lookup(flaky) error = %v, want %v", err, errTemporary)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("%d calls, want not found to be cached and temporary errors retried", calls.Load())
+	}
+
+	calls.Store(0)
+	uncached := Memoize(func(context.Context, int) (int, error) {
+		calls.Add(1)
+		return 0, errTemporary
+	}, WithCacheOptions(WithNegativeTTL(time.Minute)))
+	uncached(ctx, 1)
+	uncached(ctx, 1)
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want the error cached by the negative TTL of the cache", calls.Load())
+	}
+}
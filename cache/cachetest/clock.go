@@ -0,0 +1,87 @@
+// Package cachetest provides utilities to test code using the cache package.
+package cachetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nqhuytb99/utils/cache"
+)
+
+var _ cache.Clock = (*FakeClock)(nil)
+
+// FakeClock is a cache.Clock whose time only moves when it is advanced, so that expirations and
+// garbage collections happen at deterministic points of a test, see cache.WithClock.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+}
+
+// ticker is a periodic call registered with Every.
+type ticker struct {
+	interval time.Duration
+	next     time.Time
+	fn       func(time.Time)
+}
+
+// NewFakeClock returns a fake clock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Every registers fn to be called by Advance every interval from now until stop is called.
+func (c *FakeClock) Every(interval time.Duration, fn func(now time.Time)) (stop func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &ticker{interval: interval, next: c.now.Add(interval), fn: fn}
+	c.tickers = append(c.tickers, t)
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, other := range c.tickers {
+			if other == t {
+				c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Advance moves the clock forward by d. Each tick due in the meantime is delivered in order, the
+// clock reading the time of the tick, and its call has returned by the time Advance returns, e.g.
+// the entries expired before the new time are collected. Ticks are called from the calling goroutine.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		var due *ticker
+		for _, t := range c.tickers {
+			if !t.next.After(end) && (due == nil || t.next.Before(due.next)) {
+				due = t
+			}
+		}
+		if due == nil {
+			break
+		}
+
+		now := due.next
+		c.now = now
+		due.next = now.Add(due.interval)
+		c.mu.Unlock()
+		due.fn(now)
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package cache
+
+import "time"
+
+// Clock is the source of time of a cache, used to expire its entries and to schedule its garbage
+// collection. Tests can replace the system clock with WithClock, see cachetest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Every calls fn with the current time every interval until stop is called.
+	Every(interval time.Duration, fn func(now time.Time)) (stop func())
+}
+
+// SystemClock is the Clock reading the system time, the default of the caches.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Every calls fn from a goroutine driven by a time.Ticker, ticks are dropped while fn runs.
+func (SystemClock) Every(interval time.Duration, fn func(now time.Time)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
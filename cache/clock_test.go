@@ -0,0 +1,575 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nqhuytb99/utils/cache"
+	"github.com/nqhuytb99/utils/cache/cachetest"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestClockExpiry(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC())
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Minute)
+	c.SetNoExpire("forever", "value")
+	if ttl, ok := c.TTL("a"); !ok || ttl != time.Minute {
+		t.Errorf("TTL(a) = %v, %v, want exactly a minute", ttl, ok)
+	}
+
+	clock.Advance(30 * time.Second)
+	if ttl, _ := c.TTL("a"); ttl != 30*time.Second {
+		t.Errorf("TTL(a) = %v after 30s, want 30s", ttl)
+	}
+	if !c.Touch("b", time.Hour) {
+		t.Error("Touch(b) should find the key")
+	}
+
+	clock.Advance(30 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a expires after its deadline, not at it")
+	}
+
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Peek("a"); ok {
+		t.Error("Peek(a) should not return an expired entry")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) should not return an expired entry")
+	}
+	if ttl, ok := c.TTL("b"); !ok || ttl != time.Hour-30*time.Second-time.Nanosecond {
+		t.Errorf("TTL(b) = %v, %v after Touch", ttl, ok)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if _, ok := c.Get("forever"); !ok {
+		t.Error("an entry without expiration should never expire")
+	}
+	if st := c.Stats(); st.Expirations != 1 || st.Entries != 2 {
+		t.Errorf("%d expirations and %d entries, b is only removed once read", st.Expirations, st.Entries)
+	}
+}
+
+func TestClockGarbageCollection(t *testing.T) {
+	type event struct {
+		key    string
+		reason cache.EvictReason
+	}
+	var events []event
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](
+		cache.WithClock(clock),
+		cache.WithGCInterval(time.Minute),
+		cache.WithMaxEntries(5000),
+		cache.WithOnEvict(func(key, _ string, reason cache.EvictReason) {
+			events = append(events, event{key, reason})
+		}),
+	)
+	defer c.Close()
+
+	// More entries than a single garbage collection batch.
+	const expiring = 3000
+	for i := 0; i < expiring; i++ {
+		c.Set(fmt.Sprint(i), "value", time.Duration(i%30+1)*time.Second)
+	}
+	c.Set("alive", "value", 90*time.Second)
+
+	clock.Advance(59 * time.Second)
+	if len(events) != 0 {
+		t.Fatalf("%d entries collected before the first tick", len(events))
+	}
+
+	clock.Advance(time.Second)
+	if st := c.Stats(); st.Entries != 1 || st.Expirations != expiring {
+		t.Errorf("%d entries left and %d expirations after the first tick, want 1 and %d", st.Entries, st.Expirations, expiring)
+	}
+	for _, e := range events {
+		if e.reason != cache.EvictExpired {
+			t.Fatalf("%s removed with reason %v, want %v", e.key, e.reason, cache.EvictExpired)
+		}
+	}
+
+	clock.Advance(2 * time.Minute)
+	if c.Len() != 0 || len(events) != expiring+1 {
+		t.Errorf("alive should have been collected by the second tick, %d entries left", c.Len())
+	}
+
+	c.Close()
+	c.Set("closed", "value", time.Second)
+	clock.Advance(time.Hour)
+	if c.Len() != 1 {
+		t.Error("a closed cache should no longer collect garbage")
+	}
+}
+
+func TestClockEviction(t *testing.T) {
+	var evicted []string
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithMaxEntries(2),
+		cache.WithOnEvict(func(key, _ string, reason cache.EvictReason) {
+			evicted = append(evicted, fmt.Sprintf("%s:%v", key, reason))
+		}),
+	)
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Hour)
+	clock.Advance(time.Minute + time.Second)
+	c.Get("a")
+	c.Set("c", "value", time.Hour)
+	c.Get("b")
+	c.Set("d", "value", time.Hour)
+
+	want := fmt.Sprintf("[a:%v c:%v]", cache.EvictExpired, cache.EvictCapacity)
+	if got := fmt.Sprint(evicted); got != want {
+		t.Errorf("evicted %s, want %s", got, want)
+	}
+}
+
+func TestClockSlidingExpiration(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC(), cache.WithSlidingExpiration())
+
+	c.Set("session", "value", time.Minute)
+	for i := 0; i < 5; i++ {
+		clock.Advance(50 * time.Second)
+		if _, ok := c.Get("session"); !ok {
+			t.Fatalf("session expired after %d accesses", i)
+		}
+	}
+	if _, ok := c.Peek("session"); !ok {
+		t.Fatal("session should be alive a minute after its last access")
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if _, ok := c.Get("session"); ok {
+		t.Error("session should expire once it is no longer accessed")
+	}
+}
+
+func TestClockNegativeTTL(t *testing.T) {
+	errBackend := errors.New("backend down")
+	calls := 0
+	loader := func(ctx context.Context) (string, time.Duration, error) {
+		calls++
+		return "", 0, errBackend
+	}
+
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC(), cache.WithNegativeTTL(time.Minute))
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad(context.Background(), "key", loader); !errors.Is(err, errBackend) {
+			t.Errorf("GetOrLoad() error = %v, want %v", err, errBackend)
+		}
+		clock.Advance(30 * time.Second)
+	}
+	if calls != 2 {
+		t.Errorf("loader called %d times in 90s with a negative TTL of a minute, want 2", calls)
+	}
+}
+
+// reloads returns a cache option reporting the values replaced by the loader, and the channel they are sent to.
+func reloads() (cache.CacheOption, chan string) {
+	replaced := make(chan string, 1)
+	return cache.WithOnEvict(func(_, value string, reason cache.EvictReason) {
+		if reason == cache.EvictReplaced {
+			replaced <- value
+		}
+	}), replaced
+}
+
+func TestClockStaleWhileRevalidate(t *testing.T) {
+	loader := func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "fresh", time.Minute, nil
+	}
+	onReload, replaced := reloads()
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithLoader(loader),
+		cache.WithStaleWhileRevalidate(time.Minute),
+		onReload,
+	)
+
+	c.Set("key", "stale", time.Minute)
+	clock.Advance(90 * time.Second)
+	if data, ok := c.Get("key"); !ok || data != "stale" {
+		t.Fatalf("Get() = %q, %v, want the stale value while revalidating", data, ok)
+	}
+	if old := <-replaced; old != "stale" {
+		t.Errorf("the reload replaced %q, want stale", old)
+	}
+	if data, _ := c.Get("key"); data != "fresh" {
+		t.Errorf("Get() = %q after the reload, want fresh", data)
+	}
+
+	c.Set("other", "stale", time.Minute)
+	clock.Advance(2*time.Minute + time.Second)
+	if _, ok := c.Get("other"); ok {
+		t.Error("other should have expired past its stale duration")
+	}
+}
+
+func TestClockKCacheStaleWhileRevalidate(t *testing.T) {
+	loader := func(ctx context.Context, key int) (string, time.Duration, error) {
+		return fmt.Sprint("fresh ", key), time.Minute, nil
+	}
+	replaced := make(chan string, 1)
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.NewKCache[int, string](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithLoader(loader),
+		cache.WithStaleWhileRevalidate(time.Minute),
+		cache.WithOnEvict(func(_ int, value string, reason cache.EvictReason) {
+			if reason == cache.EvictReplaced {
+				replaced <- value
+			}
+		}),
+	)
+
+	c.Set(7, "stale", time.Minute)
+	clock.Advance(90 * time.Second)
+	if data, ok := c.Get(7); !ok || data != "stale" {
+		t.Fatalf("Get() = %q, %v, want the stale value while revalidating", data, ok)
+	}
+	if old := <-replaced; old != "stale" {
+		t.Errorf("the reload replaced %q, want stale", old)
+	}
+	if data, _ := c.Get(7); data != "fresh 7" {
+		t.Errorf("Get() = %q after the reload, want fresh 7", data)
+	}
+}
+
+func TestClockRefreshAhead(t *testing.T) {
+	loader := func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "fresh", time.Minute, nil
+	}
+	onReload, replaced := reloads()
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithLoader(loader),
+		cache.WithRefreshAhead(0.5),
+		onReload,
+	)
+
+	c.Set("key", "old", time.Minute)
+	clock.Advance(29 * time.Second)
+	c.Get("key")
+	select {
+	case <-replaced:
+		t.Fatal("key was refreshed before its refresh point")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	if data, _ := c.Get("key"); data != "old" {
+		t.Fatalf("Get() = %q, the refresh should run in the background", data)
+	}
+	if old := <-replaced; old != "old" {
+		t.Errorf("the refresh replaced %q, want old", old)
+	}
+	if ttl, _ := c.TTL("key"); ttl != time.Minute {
+		t.Errorf("TTL() = %v after the refresh, want a minute", ttl)
+	}
+}
+
+func TestClockSlidingRefresh(t *testing.T) {
+	loader := func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "fresh", time.Minute, nil
+	}
+	onReload, replaced := reloads()
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithLoader(loader),
+		cache.WithRefreshAhead(0.5),
+		cache.WithSlidingExpiration(),
+		onReload,
+	)
+
+	// Hits slide the expiration of the hot key, not its refresh point.
+	c.Set("key", "old", time.Minute)
+	for i := 0; i < 3; i++ {
+		clock.Advance(20 * time.Second)
+		c.Get("key")
+	}
+	select {
+	case old := <-replaced:
+		if old != "old" {
+			t.Errorf("the refresh replaced %q, want old", old)
+		}
+	case <-time.After(time.Second):
+		t.Error("the hot key was never refreshed")
+	}
+}
+
+func TestClockKCache(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.NewKCache[int, string](cache.WithClock(clock), cache.WithGCInterval(time.Minute))
+	defer c.Close()
+
+	c.Set(1, "one", time.Second)
+	c.Set(2, "two", 2*time.Minute)
+	clock.Advance(time.Second + time.Nanosecond)
+	if _, ok := c.Get(1); ok {
+		t.Error("1 has expired")
+	}
+
+	c.Set(3, "three", time.Second)
+	clock.Advance(time.Minute)
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d after the garbage collection, want 1", c.Len())
+	}
+}
+
+func TestClockBytesCache(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.NewBytesCache(cache.WithClock(clock), cache.WithCapacity(1<<16))
+
+	c.Set("key", []byte("value"), time.Minute)
+	clock.Advance(time.Minute)
+	if _, ok := c.Get("key"); !ok {
+		t.Error("key expires after its deadline, not at it")
+	}
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Get("key"); ok {
+		t.Error("key has expired")
+	}
+}
+
+func TestClockSnapshot(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC())
+	c.Set("short", "value", time.Minute)
+	c.Set("long", "value", time.Hour)
+
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(30 * time.Minute)
+	restored := cache.New[string](cache.WithClock(clock), cache.WithoutGC())
+	if err := restored.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.Get("short"); ok {
+		t.Error("short expired while the snapshot was stored")
+	}
+	if ttl, ok := restored.TTL("long"); !ok || ttl != 30*time.Minute {
+		t.Errorf("TTL(long) = %v, %v, want the half hour left", ttl, ok)
+	}
+}
+
+func TestClockSnapshotSliding(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC(), cache.WithSlidingExpiration())
+	c.Set("session", "value", time.Hour)
+	clock.Advance(59 * time.Minute)
+
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := cache.New[string](cache.WithClock(clock), cache.WithoutGC(), cache.WithSlidingExpiration())
+	if err := restored.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := restored.TTL("session"); ttl != time.Minute {
+		t.Errorf("TTL() = %v after the restore, want the minute left", ttl)
+	}
+	restored.Get("session")
+	if ttl, _ := restored.TTL("session"); ttl != time.Hour {
+		t.Errorf("TTL() = %v after a hit, the restored entry should slide by its hour", ttl)
+	}
+}
+
+func TestClockSnapshotStale(t *testing.T) {
+	loader := func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "fresh", time.Minute, nil
+	}
+	clock := cachetest.NewFakeClock(epoch)
+	newCache := func() *cache.Cache[string] {
+		return cache.New[string](
+			cache.WithClock(clock),
+			cache.WithoutGC(),
+			cache.WithLoader(loader),
+			cache.WithStaleWhileRevalidate(time.Hour),
+		)
+	}
+
+	c := newCache()
+	c.Set("key", "value", time.Minute)
+	c.Set("stale", "value", time.Minute)
+	clock.Advance(2 * time.Minute)
+	c.Set("key", "value", time.Minute)
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if err := c.SaveTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		c = newCache()
+		if err := c.LoadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if ttl, _ := c.TTL("key"); ttl != time.Hour+time.Minute {
+			t.Fatalf("TTL() = %v after %d restores, want the stale window counted once", ttl, i+1)
+		}
+		if ttl, _ := c.TTL("stale"); ttl != time.Hour-time.Minute {
+			t.Fatalf("TTL(stale) = %v after %d restores, want the rest of its stale window", ttl, i+1)
+		}
+	}
+}
+
+func TestClockDefaultTTL(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[string](cache.WithClock(clock), cache.WithoutGC(), cache.WithDefaultTTL(time.Minute))
+
+	c.SetDefault("default", "value")
+	c.Set("zero", "value", 0)
+	c.Set("explicit", "value", time.Hour)
+	c.SetNoExpire("forever", "value")
+	c.GetOrLoad(context.Background(), "loaded", func(context.Context) (string, time.Duration, error) {
+		return "value", cache.DefaultExpiration, nil
+	})
+
+	for key, want := range map[string]time.Duration{
+		"default":  time.Minute,
+		"zero":     0,
+		"explicit": time.Hour,
+		"forever":  cache.NoExpiration,
+		"loaded":   time.Minute,
+	} {
+		if ttl, ok := c.TTL(key); !ok || ttl != want {
+			t.Errorf("TTL(%s) = %v, %v, want %v", key, ttl, ok, want)
+		}
+	}
+
+	if !c.Touch("explicit", cache.DefaultExpiration) {
+		t.Fatal("Touch(explicit) should find the key")
+	}
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Get("zero"); ok {
+		t.Error("an entry set with 0 should expire immediately, not after the default TTL")
+	}
+	clock.Advance(time.Minute + time.Second)
+	if c.Len() != 4 || len(c.Keys()) != 1 {
+		t.Errorf("keys %v alive, want only forever", c.Keys())
+	}
+
+	c = cache.New[string](cache.WithClock(clock), cache.WithoutGC())
+	c.SetDefault("key", "value")
+	if ttl, _ := c.TTL("key"); ttl != cache.NoExpiration {
+		t.Errorf("TTL() = %v without a default TTL, want NoExpiration", ttl)
+	}
+
+	counters := cache.New[int](cache.WithClock(clock), cache.WithoutGC(), cache.WithDefaultTTL(time.Minute))
+	cache.Increment(counters, "hits", 1)
+	clock.Advance(time.Second)
+	cache.Increment(counters, "hits", 1)
+	if ttl, _ := counters.TTL("hits"); ttl != time.Minute-time.Second {
+		t.Errorf("TTL() = %v, want a counter created by Increment to keep the default TTL", ttl)
+	}
+}
+
+func TestClockTTLJitter(t *testing.T) {
+	clock := cachetest.NewFakeClock(epoch)
+	c := cache.New[int](cache.WithClock(clock), cache.WithoutGC(), cache.WithTTLJitter(0.2))
+
+	ttls := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), i, 10*time.Minute)
+		ttl, _ := c.TTL(fmt.Sprint(i))
+		if ttl < 8*time.Minute || ttl > 10*time.Minute {
+			t.Fatalf("TTL() = %v, want between 8 and 10 minutes", ttl)
+		}
+		ttls[ttl] = true
+	}
+	if len(ttls) < 900 {
+		t.Errorf("%d distinct TTLs out of 1000, the expirations should be spread", len(ttls))
+	}
+
+	c.SetNoExpire("forever", 0)
+	if ttl, _ := c.TTL("forever"); ttl != cache.NoExpiration {
+		t.Errorf("TTL(forever) = %v, the jitter only applies to expiring entries", ttl)
+	}
+
+	clock.Advance(9 * time.Minute)
+	if n := len(c.Keys()); n <= 1 || n >= 1001 {
+		t.Errorf("%d entries alive after 9 minutes, want some of them expired", n)
+	}
+	clock.Advance(time.Minute + time.Nanosecond)
+	if n := len(c.Keys()); n != 1 {
+		t.Errorf("%d entries alive after 10 minutes, want only forever", n)
+	}
+}
+
+func TestClockExpirationPolicy(t *testing.T) {
+	type token struct {
+		subject string
+		exp     time.Time
+	}
+	clock := cachetest.NewFakeClock(epoch)
+	policy := func(_ string, tok token) time.Duration {
+		if tok.exp.IsZero() {
+			return cache.NoExpiration
+		}
+		return tok.exp.Sub(clock.Now())
+	}
+	c := cache.New[token](
+		cache.WithClock(clock),
+		cache.WithoutGC(),
+		cache.WithDefaultTTL(time.Hour),
+		cache.WithExpirationPolicy(policy),
+	)
+
+	c.SetDefault("short", token{"a", epoch.Add(time.Minute)})
+	c.SetDefault("long", token{"b", epoch.Add(2 * time.Hour)})
+	c.SetDefault("default", token{subject: "c"})
+	c.Set("explicit", token{"d", epoch.Add(time.Minute)}, 3*time.Hour)
+	c.SetDefault("expired", token{"e", epoch.Add(-time.Second)})
+	c.SetDefault("now", token{"f", epoch})
+
+	for key, want := range map[string]time.Duration{
+		"short":    time.Minute,
+		"long":     2 * time.Hour,
+		"default":  cache.NoExpiration,
+		"explicit": 3 * time.Hour,
+		"now":      0,
+	} {
+		if ttl, ok := c.TTL(key); !ok || ttl != want {
+			t.Errorf("TTL(%s) = %v, %v, want %v", key, ttl, ok, want)
+		}
+	}
+	if _, ok := c.Get("expired"); ok {
+		t.Error("an expired token should not be returned")
+	}
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Get("now"); ok {
+		t.Error("a policy returning 0 should expire the entry immediately, not after the default TTL")
+	}
+
+	n := cache.NewKCache[int, token](cache.WithClock(clock), cache.WithExpirationPolicy(func(_ int, tok token) time.Duration {
+		return tok.exp.Sub(clock.Now())
+	}))
+	defer n.Close()
+	n.Set(1, token{"a", clock.Now().Add(time.Minute)}, cache.DefaultExpiration)
+	if ttl, _ := n.TTL(1); ttl != time.Minute {
+		t.Errorf("KCache TTL() = %v, want the expiration of the token", ttl)
+	}
+}
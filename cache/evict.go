@@ -0,0 +1,75 @@
+package cache
+
+import "fmt"
+
+// EvictReason tells why an entry left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity means the eviction policy removed the entry to make room.
+	EvictCapacity EvictReason = iota
+	// EvictExpired means the entry reached its expiration time.
+	EvictExpired
+	// EvictDeleted means the entry was removed by a Delete method or InvalidateTag.
+	EvictDeleted
+	// EvictPruned means the entry was removed by Prune or PruneNamespace.
+	EvictPruned
+	// EvictReplaced means the entry was overwritten by a new value for the same key.
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictPruned:
+		return "pruned"
+	case EvictReplaced:
+		return "replaced"
+	default:
+		return fmt.Sprintf("EvictReason(%d)", int(r))
+	}
+}
+
+// removal is an entry removed from a shard, waiting to be reported to the eviction callback.
+type removal[K comparable, V any] struct {
+	entry  *CacheEntry[K, V]
+	reason EvictReason
+}
+
+// removed counts the removal of the entry and records it when an eviction callback is registered.
+// The caller must hold the lock.
+func (s *shard[K, V]) removed(entry *CacheEntry[K, V], reason EvictReason) {
+	s.stats.removals[reason].Add(1)
+	if entry.ns != nil {
+		entry.ns.stats.removals[reason].Add(1)
+	}
+	if s.onEvict == nil {
+		return
+	}
+
+	s.removals = append(s.removals, removal[K, V]{entry: entry, reason: reason})
+	s.pending.Store(true)
+}
+
+// notify reports the removals recorded by the shard to the eviction callback.
+// It must be called without holding the lock so that the callback may use the cache.
+func (s *shard[K, V]) notify() {
+	if !s.pending.Load() {
+		return
+	}
+
+	s.locker.Lock()
+	removals := s.removals
+	s.removals = nil
+	s.pending.Store(false)
+	s.locker.Unlock()
+
+	for _, r := range removals {
+		s.onEvict(r.entry.key, r.entry.data, r.reason)
+	}
+}
@@ -0,0 +1,35 @@
+package cache
+
+// expiryHeap is a min-heap of entries ordered by expiration time, see container/heap.
+// Every entry keeps its position in index so that it can be removed in O(log n).
+type expiryHeap[K comparable, V any] []*CacheEntry[K, V]
+
+func (h expiryHeap[K, V]) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap[K, V]) Less(i, j int) bool {
+	return h[i].exp.Before(h[j].exp)
+}
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	entry := x.(*CacheEntry[K, V])
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
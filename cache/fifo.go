@@ -0,0 +1,25 @@
+package cache
+
+// fifoQueue evicts keys in insertion order, hits and overwrites do not change the order.
+type fifoQueue struct {
+	queue *lruQueue
+}
+
+// NewFIFOPolicy returns a policy that evicts the oldest inserted key.
+func NewFIFOPolicy() EvictionPolicy {
+	return &fifoQueue{queue: newLRUQueue()}
+}
+
+func (q *fifoQueue) Add(key uint64) {
+	q.queue.moveToFront(key)
+}
+
+func (q *fifoQueue) Access(uint64) {}
+
+func (q *fifoQueue) Remove(key uint64) {
+	q.queue.remove(key)
+}
+
+func (q *fifoQueue) Evict() (uint64, bool) {
+	return q.queue.removeFromTail()
+}
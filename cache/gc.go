@@ -1,26 +1,75 @@
 package cache
 
-import "time"
-
-// startGC starts a goroutine that periodically calls the collectGarbage method on the cache object.
-func (c *Cache[T]) startGC(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			c.collectGarbage()
-		}
-	}()
+import (
+	"sync"
+	"time"
+)
+
+// gcBatchSize is the number of expired entries removed per lock acquisition.
+const gcBatchSize = 1024
+
+// janitor runs the periodic garbage collection of a cache until it is stopped.
+type janitor struct {
+	stopGC func()
+	once   sync.Once
+}
+
+func (j *janitor) stop() {
+	j.once.Do(j.stopGC)
+}
+
+// newJanitor starts the periodic garbage collection of the shards and of the load failures on the clock,
+// or returns nil if the interval is not positive. The collection only references the shards, so that
+// the cache can be garbage collected and closed by its finalizer when it is no longer used.
+func newJanitor[K comparable, V any](shards []*shard[K, V], loads *loadGroup[K, V], clock Clock, interval time.Duration) *janitor {
+	if interval <= 0 {
+		return nil
+	}
+
+	return &janitor{
+		stopGC: clock.Every(interval, func(now time.Time) {
+			for _, s := range shards {
+				s.collectGarbage(now)
+			}
+			loads.collectGarbage(now)
+		}),
+	}
+}
+
+// Close stops the garbage collection goroutine of the cache and its subscription to the invalidator.
+// Expired entries are still removed when they are read. Close is idempotent.
+func (c *engine[K, V]) Close() {
+	if c.janitor != nil {
+		c.janitor.stop()
+	}
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
 }
 
-// collectGarbage removes expired items from the cache.
-func (c *Cache[T]) collectGarbage() {
-	c.locker.Lock()
-	defer c.locker.Unlock()
+// collectGarbage removes expired items from the cache, one shard at a time, and the expired load failures.
+func (c *engine[K, V]) collectGarbage() {
+	now := c.clock.Now()
+	for _, s := range c.shards {
+		s.collectGarbage(now)
+	}
+	c.loads.collectGarbage(now)
+}
+
+// collectGarbage removes the entries expired at now in batches, releasing the lock between them.
+func (s *shard[K, V]) collectGarbage(now time.Time) {
+	for {
+		s.locker.Lock()
+		n := 0
+		for ; n < gcBatchSize && len(s.expiries) > 0 && s.expiries[0].exp.Before(now); n++ {
+			entry := s.expiries[0]
+			s.delete(entry.hash, entry.key, EvictExpired)
+		}
+		s.locker.Unlock()
+		s.notify()
 
-	now := time.Now()
-	for key, entry := range c.items {
-		if entry.exp.Before(now) {
-			c.delete(key)
+		if n < gcBatchSize {
+			return
 		}
 	}
 }
@@ -0,0 +1,431 @@
+// Package httpcache provides net/http middleware caching responses in a cache.Cache, as a shared cache
+// in front of the handlers of a server.
+package httpcache
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nqhuytb99/utils/cache"
+)
+
+// CachedResponse is a response stored by the middleware.
+// A response varying on request headers is stored under a variant key, the entry of the request key
+// then only holds the names of the headers in Vary.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Vary       []string
+	// StoredAt is the time the response was generated, used for its Age header.
+	StoredAt time.Time
+	// Expires is the time the response becomes stale and must be revalidated.
+	Expires time.Time
+}
+
+// cacheableStatus are the status codes of the responses cacheable by default, see RFC 9110 section 15.1.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Cache status values of the X-Cache response header.
+const (
+	statusHit         = "HIT"
+	statusMiss        = "MISS"
+	statusRevalidated = "REVALIDATED"
+)
+
+// middleware stores the responses of next in the cache.
+type middleware struct {
+	cache *cache.Cache[CachedResponse]
+	next  http.Handler
+	options
+}
+
+// Middleware returns a middleware caching the responses of the handlers in c, honoring Cache-Control,
+// Expires, Vary and the ETag and Last-Modified validators. It answers conditional requests matching a
+// cached response with 304 Not Modified, and marks its responses with an X-Cache header set to HIT,
+// MISS or REVALIDATED.
+//
+// Only GET responses are stored, HEAD requests are served from them. As a shared cache, it does not store
+// responses that are private, set cookies or answer authorized requests unless they are public.
+// A successful unsafe request, e.g. POST, removes the cached responses of its URL.
+func Middleware(c *cache.Cache[CachedResponse], options ...Option) func(http.Handler) http.Handler {
+	o := defaultOptions()
+	for _, option := range options {
+		option.apply(&o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return &middleware{cache: c, next: next, options: o}
+	}
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := m.keyFunc(r)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rec := newRecorder(w, 0)
+		rec.overflow = true // Only the status is needed.
+		m.next.ServeHTTP(rec, r)
+		if rec.status < http.StatusBadRequest {
+			m.cache.InvalidateTag(key)
+		}
+		return
+	}
+
+	directives := parseCacheControl(r.Header)
+	if _, ok := directives["no-store"]; ok {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	now := time.Now()
+	resp, ok := m.lookup(r, key)
+	_, noCache := directives["no-cache"]
+	switch {
+	case ok && !noCache && now.Before(resp.Expires):
+		serve(w, r, resp, statusHit, now)
+	case ok && hasValidators(resp.Header):
+		m.revalidate(w, r, key, resp, now)
+	default:
+		m.fetch(w, r, key, now)
+	}
+}
+
+// lookup returns the response cached for the request, resolving the variant of the request if the
+// response varies.
+func (m *middleware) lookup(r *http.Request, key string) (CachedResponse, bool) {
+	resp, ok := m.cache.Get(key)
+	if !ok || resp.Vary == nil {
+		return resp, ok
+	}
+	return m.cache.Get(variantKey(key, resp.Vary, r.Header))
+}
+
+// fetch serves the request with the next handler, streaming its response to the client,
+// and stores the response if it is cacheable.
+func (m *middleware) fetch(w http.ResponseWriter, r *http.Request, key string, now time.Time) {
+	w.Header().Set("X-Cache", statusMiss)
+	rec := newRecorder(w, m.maxBodySize)
+	m.next.ServeHTTP(rec, r)
+	if r.Method == http.MethodGet && !rec.overflow {
+		m.store(r, key, rec.response(now))
+	}
+}
+
+// revalidate asks the next handler whether the stale response is still valid with a conditional request.
+// The response is served from the cache if the handler answers 304 Not Modified, otherwise the new
+// response replaces it.
+func (m *middleware) revalidate(w http.ResponseWriter, r *http.Request, key string, stale CachedResponse, now time.Time) {
+	conditional := r.Clone(r.Context())
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		conditional.Header.Del(name)
+	}
+	if etag := stale.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := stale.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	rec := newRecorder(nil, m.maxBodySize)
+	m.next.ServeHTTP(rec, conditional)
+	if rec.status != http.StatusNotModified {
+		resp := rec.response(now)
+		if !rec.overflow && r.Method == http.MethodGet {
+			m.store(r, key, resp)
+		}
+		if rec.overflow {
+			// The body was not kept, the request has to be served again.
+			m.fetch(w, r, key, now)
+			return
+		}
+		serve(w, r, resp, statusMiss, now)
+		return
+	}
+
+	// Update the stored response with the headers of the 304 response, see RFC 9111 section 4.3.4.
+	resp := stale
+	resp.Header = stale.Header.Clone()
+	for name, values := range rec.header {
+		if name != "Content-Length" {
+			resp.Header[name] = values
+		}
+	}
+	resp.StoredAt = now
+	m.store(r, key, resp)
+	serve(w, r, resp, statusRevalidated, now)
+}
+
+// store caches the response of the request if it is cacheable, tagging every variant with the key
+// so that they are invalidated together.
+func (m *middleware) store(r *http.Request, key string, resp CachedResponse) {
+	if !storable(r, resp) {
+		return
+	}
+
+	lifetime, ok := freshness(resp.Header, resp.StoredAt)
+	if !ok && !hasValidators(resp.Header) {
+		return
+	}
+	resp.Expires = resp.StoredAt.Add(lifetime)
+	ttl := time.Until(resp.Expires)
+	if hasValidators(resp.Header) {
+		ttl += m.staleTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	vary := varyHeaders(resp.Header)
+	if vary == nil {
+		m.cache.SetWithTags(key, resp, ttl, key)
+		return
+	}
+	m.cache.SetWithTags(key, CachedResponse{Vary: vary}, ttl, key)
+	m.cache.SetWithTags(variantKey(key, vary, r.Header), resp, ttl, key)
+}
+
+// storable reports whether a shared cache may store the response of the request, see RFC 9111 section 3.
+func storable(r *http.Request, resp CachedResponse) bool {
+	if !cacheableStatus[resp.StatusCode] || resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	directives := parseCacheControl(resp.Header)
+	for _, directive := range []string{"no-store", "private"} {
+		if _, ok := directives[directive]; ok {
+			return false
+		}
+	}
+	if slices.Contains(varyHeaders(resp.Header), "*") {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" {
+		_, public := directives["public"]
+		_, sharedMaxAge := directives["s-maxage"]
+		_, mustRevalidate := directives["must-revalidate"]
+		return public || sharedMaxAge || mustRevalidate
+	}
+	return true
+}
+
+// freshness returns how long a response generated at storedAt is fresh for a shared cache, see RFC 9111
+// section 4.2.1. It reports false when the response has no explicit expiration.
+func freshness(header http.Header, storedAt time.Time) (time.Duration, bool) {
+	directives := parseCacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[directive]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires means the response is already stale.
+			return 0, true
+		}
+		date := storedAt
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return max(t.Sub(date), 0), true
+	}
+	return 0, false
+}
+
+// serve writes the cached response, or 304 Not Modified if the conditional request matches it.
+func serve(w http.ResponseWriter, r *http.Request, resp CachedResponse, status string, now time.Time) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		header[name] = slices.Clone(values)
+	}
+	header.Set("Age", strconv.Itoa(int(max(now.Sub(resp.StoredAt), 0)/time.Second)))
+	header.Set("X-Cache", status)
+
+	if notModified(r, resp.Header) {
+		header.Del("Content-Length")
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+}
+
+// notModified reports whether the validators of the conditional request match the response,
+// see RFC 9110 section 13.2.2.
+func notModified(r *http.Request, header http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(ifModifiedSince)
+}
+
+func hasValidators(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// parseCacheControl returns the Cache-Control directives, lowercased, with their unquoted value if any.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// varyHeaders returns the canonical names of the request headers in the Vary header, sorted.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// variantKey returns the key of the variant of the response selected by the request headers.
+func variantKey(key string, vary []string, header http.Header) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// recorder records a response while streaming it to the client, or only records it when w is nil.
+// The body is no longer recorded once it exceeds maxBodySize, unless it is zero.
+type recorder struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	maxBodySize int
+	overflow    bool
+	wroteHeader bool
+}
+
+func newRecorder(w http.ResponseWriter, maxBodySize int) *recorder {
+	rec := &recorder{w: w, header: make(http.Header), maxBodySize: maxBodySize}
+	if w != nil {
+		rec.header = w.Header()
+	}
+	return rec
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = status
+	// Keep the headers as sent, later changes are ignored by the client too.
+	rec.header = rec.header.Clone()
+	if rec.w != nil {
+		rec.w.WriteHeader(status)
+	}
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if rec.maxBodySize > 0 && rec.body.Len()+len(p) > rec.maxBodySize {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	if rec.w != nil {
+		return rec.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// Flush flushes the client response when streaming it.
+func (rec *recorder) Flush() {
+	if flusher, ok := rec.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// response returns the recorded response, generated at now.
+func (rec *recorder) response(now time.Time) CachedResponse {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	header := rec.header.Clone()
+	header.Del("X-Cache")
+	storedAt := now
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		storedAt = now.Add(-time.Duration(age) * time.Second)
+	}
+	header.Del("Age")
+	return CachedResponse{
+		StatusCode: rec.status,
+		Header:     header,
+		Body:       bytes.Clone(rec.body.Bytes()),
+		StoredAt:   storedAt,
+	}
+}
@@ -0,0 +1,255 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nqhuytb99/utils/cache"
+)
+
+// server returns a caching server in front of the handler and the number of requests it received.
+func server(handler http.HandlerFunc, options ...Option) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	c := cache.New[CachedResponse]()
+	return Middleware(c, options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		handler(w, r)
+	})), &calls
+}
+
+func request(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMaxAge(t *testing.T) {
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "hello "+r.URL.Path)
+	})
+
+	first := request(h, http.MethodGet, "/a")
+	second := request(h, http.MethodGet, "/a")
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, want 1", calls.Load())
+	}
+	if first.Header().Get("X-Cache") != statusMiss || second.Header().Get("X-Cache") != statusHit {
+		t.Errorf("X-Cache = %q then %q", first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+	}
+	if second.Code != http.StatusOK || second.Body.String() != "hello /a" || second.Header().Get("Age") == "" {
+		t.Errorf("cached response = %d %q with headers %v", second.Code, second.Body, second.Header())
+	}
+
+	if head := request(h, http.MethodHead, "/a"); head.Body.Len() != 0 || head.Header().Get("X-Cache") != statusHit {
+		t.Errorf("HEAD response = %q with headers %v, want a bodyless hit", head.Body, head.Header())
+	}
+	request(h, http.MethodGet, "/b")
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, other paths should not be served from the cache", calls.Load())
+	}
+}
+
+func TestExpires(t *testing.T) {
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		w.Header().Set("Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+		io.WriteString(w, "hello")
+	})
+
+	request(h, http.MethodGet, "/")
+	request(h, http.MethodGet, "/")
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, want 1", calls.Load())
+	}
+}
+
+func TestUncacheable(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"no-store": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+		},
+		"private": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		},
+		"cookie": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		},
+		"no expiration": func(w http.ResponseWriter, r *http.Request) {},
+		"error": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		"vary all": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "*")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h, calls := server(handler)
+			request(h, http.MethodGet, "/")
+			request(h, http.MethodGet, "/")
+			if calls.Load() != 2 {
+				t.Errorf("handler called %d times, the response should not be stored", calls.Load())
+			}
+		})
+	}
+
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	})
+	request(h, http.MethodGet, "/", "Cache-Control", "no-store")
+	request(h, http.MethodGet, "/", "Authorization", "Bearer token")
+	request(h, http.MethodGet, "/")
+	if calls.Load() != 3 {
+		t.Errorf("handler called %d times, no-store and authorized requests should not be stored", calls.Load())
+	}
+}
+
+func TestVary(t *testing.T) {
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, "hello "+r.Header.Get("Accept-Language"))
+	})
+
+	for i := 0; i < 2; i++ {
+		for _, lang := range []string{"en", "fr"} {
+			w := request(h, http.MethodGet, "/", "Accept-Language", lang)
+			if w.Body.String() != "hello "+lang {
+				t.Errorf("body = %q for %s", w.Body, lang)
+			}
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want once per language", calls.Load())
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC()
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		io.WriteString(w, "hello")
+	})
+	request(h, http.MethodGet, "/")
+
+	for _, header := range [][]string{
+		{"If-None-Match", `"v1"`},
+		{"If-None-Match", `"v0", W/"v1"`},
+		{"If-Modified-Since", lastModified.Format(http.TimeFormat)},
+	} {
+		w := request(h, http.MethodGet, "/", header...)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: %s response = %d %q, want 304", header[0], header[1], w.Code, w.Body)
+		}
+	}
+	if w := request(h, http.MethodGet, "/", "If-None-Match", `"v0"`); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("response = %d %q, want the cached response", w.Code, w.Body)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, conditional requests should be answered by the cache", calls.Load())
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	var notModified atomic.Int32
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "hello")
+	}, WithStaleTTL(time.Minute))
+
+	request(h, http.MethodGet, "/")
+	w := request(h, http.MethodGet, "/")
+	if calls.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("handler called %d times with %d 304, want the cached response revalidated", calls.Load(), notModified.Load())
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "hello" || w.Header().Get("X-Cache") != statusRevalidated {
+		t.Errorf("revalidated response = %d %q with headers %v", w.Code, w.Body, w.Header())
+	}
+
+	// Without a stale TTL the response is generated again.
+	h, calls = server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") != "" {
+			t.Error("unexpected conditional request")
+		}
+	})
+	request(h, http.MethodGet, "/")
+	request(h, http.MethodGet, "/")
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want 2", calls.Load())
+	}
+}
+
+func TestUnsafeMethodInvalidation(t *testing.T) {
+	body := "v1"
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body = "v2"
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept")
+		io.WriteString(w, body)
+	})
+
+	request(h, http.MethodGet, "/resource")
+	request(h, http.MethodPost, "/resource")
+	if w := request(h, http.MethodGet, "/resource"); w.Body.String() != "v2" {
+		t.Errorf("body = %q after POST, want v2", w.Body)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("handler called %d times, want 3", calls.Load())
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, strings.Repeat("x", 100))
+	}, WithMaxBodySize(10))
+
+	for i := 0; i < 2; i++ {
+		if w := request(h, http.MethodGet, "/"); w.Body.Len() != 100 {
+			t.Errorf("body of %d bytes, want the full response", w.Body.Len())
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, large responses should not be stored", calls.Load())
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	h, calls := server(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	}, WithKeyFunc(func(r *http.Request) string {
+		return r.URL.Path
+	}))
+
+	request(h, http.MethodGet, "/?a=1")
+	request(h, http.MethodGet, "/?a=2")
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, the query should be ignored", calls.Load())
+	}
+}
@@ -0,0 +1,65 @@
+package httpcache
+
+import (
+	"net/http"
+	"time"
+)
+
+type options struct {
+	keyFunc     func(*http.Request) string
+	staleTTL    time.Duration
+	maxBodySize int
+}
+
+func defaultOptions() options {
+	return options{
+		keyFunc:     defaultKey,
+		maxBodySize: 1 << 20,
+	}
+}
+
+// defaultKey identifies a request by its host and URI.
+func defaultKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type keyFuncOption func(*http.Request) string
+
+func (o keyFuncOption) apply(opts *options) {
+	opts.keyFunc = o
+}
+
+// WithKeyFunc sets the function returning the cache key of a request.
+// The middleware defaults to the host and URI of the request.
+func WithKeyFunc(fn func(*http.Request) string) Option {
+	return keyFuncOption(fn)
+}
+
+type staleTTLOption time.Duration
+
+func (o staleTTLOption) apply(opts *options) {
+	opts.staleTTL = time.Duration(o)
+}
+
+// WithStaleTTL keeps the responses with an ETag or Last-Modified validator in the cache for the given
+// duration once they are stale, so that they are revalidated with a conditional request to the handler
+// instead of being generated again. Stale responses are dropped by default.
+func WithStaleTTL(ttl time.Duration) Option {
+	return staleTTLOption(ttl)
+}
+
+type maxBodySizeOption int
+
+func (o maxBodySizeOption) apply(opts *options) {
+	opts.maxBodySize = int(o)
+}
+
+// WithMaxBodySize sets the size of the largest response body stored, 1 MB by default.
+// Zero removes the limit.
+func WithMaxBodySize(size int) Option {
+	return maxBodySizeOption(size)
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// InvalidationKind tells what an Invalidation removes.
+type InvalidationKind int
+
+const (
+	// InvalidationKeys removes the keys of the invalidation.
+	InvalidationKeys InvalidationKind = iota
+	// InvalidationTag removes the entries tagged with the tag of the invalidation.
+	InvalidationTag
+	// InvalidationPrefix removes the entries whose key starts with the prefix of the invalidation.
+	InvalidationPrefix
+	// InvalidationAll removes every entry.
+	InvalidationAll
+)
+
+// Invalidation is a change of a cache published to the other caches sharing its Invalidator.
+type Invalidation struct {
+	// Node identifies the publishing cache, which ignores its own invalidations.
+	Node   string           `json:"node"`
+	Kind   InvalidationKind `json:"kind"`
+	Keys   []string         `json:"keys,omitempty"`
+	Tag    string           `json:"tag,omitempty"`
+	Prefix string           `json:"prefix,omitempty"`
+}
+
+// Invalidator broadcasts invalidations between caches, see WithInvalidator.
+type Invalidator interface {
+	// Publish sends the invalidation to the subscribers of the other nodes than inv.Node.
+	// It must not wait for the subscribers to handle it: a subscriber may be publishing itself,
+	// e.g. from an eviction callback.
+	Publish(ctx context.Context, inv Invalidation) error
+	// Subscribe calls fn with every invalidation published by the other nodes than node until
+	// cancel is called. cancel is idempotent.
+	Subscribe(node string, fn func(Invalidation)) (cancel func())
+}
+
+// publishKeys publishes the invalidation of the keys, if the cache has an invalidator.
+// Only a Cache has one, so the keys are strings. They are copied since the invalidator may deliver
+// them once the caller reused its slice.
+func (c *engine[K, V]) publishKeys(keys ...K) {
+	if c.invalidator != nil && len(keys) > 0 {
+		c.publish(Invalidation{Kind: InvalidationKeys, Keys: slices.Clone(any(keys).([]string))})
+	}
+}
+
+// publish publishes the invalidation on behalf of the cache, if it has an invalidator.
+// Publishing errors are left to the invalidator to report.
+func (c *engine[K, V]) publish(inv Invalidation) {
+	if c.invalidator == nil {
+		return
+	}
+
+	inv.Node = c.node
+	c.invalidator.Publish(context.Background(), inv)
+}
+
+// invalidated applies an invalidation published by another cache, without publishing it again.
+func (c *Cache[T]) invalidated(inv Invalidation) {
+	if inv.Node == c.node {
+		return
+	}
+
+	switch inv.Kind {
+	case InvalidationKeys:
+		c.deleteMany(inv.Keys)
+	case InvalidationTag:
+		c.invalidateTag(inv.Tag)
+	case InvalidationPrefix:
+		c.deleteByPrefix(inv.Prefix, EvictDeleted)
+	case InvalidationAll:
+		c.prune()
+	}
+}
+
+type busSubscriber struct {
+	node  string
+	mu    sync.Mutex
+	queue []Invalidation
+	// ready is signaled when the queue is no longer empty.
+	ready chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// push queues the invalidation without waiting for the subscriber.
+func (s *busSubscriber) push(inv Invalidation) {
+	s.mu.Lock()
+	s.queue = append(s.queue, inv)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// InvalidationBus is an Invalidator delivering the invalidations to the subscribers of the same process.
+// Each subscriber is called from its own goroutine, in publishing order, and has an unbounded queue so
+// that publishing never waits for a slow subscriber.
+type InvalidationBus struct {
+	mu          sync.RWMutex
+	subscribers map[*busSubscriber]struct{}
+}
+
+// NewInvalidationBus creates an InvalidationBus without subscribers.
+func NewInvalidationBus() *InvalidationBus {
+	return &InvalidationBus{
+		subscribers: make(map[*busSubscriber]struct{}),
+	}
+}
+
+// Publish queues the invalidation for the subscribers of the other nodes, it never fails.
+func (b *InvalidationBus) Publish(ctx context.Context, inv Invalidation) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if sub.node != inv.Node {
+			sub.push(inv)
+		}
+	}
+	return nil
+}
+
+func (b *InvalidationBus) Subscribe(node string, fn func(Invalidation)) (cancel func()) {
+	sub := &busSubscriber{
+		node:  node,
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-sub.ready:
+				sub.mu.Lock()
+				queue := sub.queue
+				sub.queue = nil
+				sub.mu.Unlock()
+				for _, inv := range queue {
+					fn(inv)
+				}
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		sub.once.Do(func() {
+			close(sub.done)
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+		})
+	}
+}
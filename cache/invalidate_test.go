@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// invalidatedCaches returns two caches sharing the invalidator, both holding the keys
+// tagged with the part of the key before the colon.
+func invalidatedCaches(t *testing.T, newInvalidator func() Invalidator, keys ...string) (*Cache[string], *Cache[string]) {
+	a := New[string](WithInvalidator(newInvalidator()), WithPrefixIndex())
+	b := New[string](WithInvalidator(newInvalidator()))
+	t.Cleanup(a.Close)
+	t.Cleanup(b.Close)
+	for _, key := range keys {
+		tags := []string{strings.Split(key, ":")[0]}
+		a.set(a.newTaggedEntry(key, "a", time.Hour, tags))
+		b.set(b.newTaggedEntry(key, "b", time.Hour, tags))
+	}
+	return a, b
+}
+
+// synced publishes a marker from a and waits for b to apply it, so that the invalidations
+// published by a before are applied too.
+func synced(t *testing.T, a, b *Cache[string]) {
+	b.set(b.newEntry("marker", "", time.Hour, 0))
+	a.Delete("marker")
+	waitFor(t, func() bool {
+		_, ok := b.Peek("marker")
+		return !ok
+	})
+}
+
+func testInvalidator(t *testing.T, newInvalidator func() Invalidator) {
+	keys := []string{"user:1", "user:2", "order:1", "order:2", "session:1"}
+
+	a, b := invalidatedCaches(t, newInvalidator, keys...)
+	a.Set("own", "a", time.Hour)
+	synced(t, a, b)
+	if data, ok := a.Get("own"); !ok || data != "a" {
+		t.Errorf("a.Get() = %q, %v, a should ignore its own invalidations", data, ok)
+	}
+
+	a.Delete("user:1")
+	a.InvalidateTag("order")
+	a.DeleteByPrefix("session:")
+	synced(t, a, b)
+	if got := b.Keys(); len(got) != 1 || got[0] != "user:2" {
+		t.Errorf("b.Keys() = %v, want [user:2]", got)
+	}
+
+	a.Update("user:2", func(old string, _ bool) (string, bool) {
+		return old + "!", true
+	})
+	synced(t, a, b)
+	if _, ok := b.Get("user:2"); ok {
+		t.Error("user:2 should be invalidated by Update")
+	}
+
+	// Loads are not published.
+	b.GetOrLoad(context.Background(), "user:2", func(context.Context) (string, time.Duration, error) {
+		return "loaded", time.Hour, nil
+	})
+	synced(t, b, a)
+	if _, ok := a.Get("user:2"); !ok {
+		t.Error("a should keep user:2 when b loads it")
+	}
+
+	// The invalidation must not see the key buffer reused after DeleteMany.
+	buffer := []string{"user:1"}
+	a.DeleteMany(buffer)
+	buffer[0] = "user:2"
+	synced(t, a, b)
+	if _, ok := b.Peek("user:2"); !ok {
+		t.Error("b deleted user:2, which a reused its key buffer for after DeleteMany")
+	}
+
+	a, b = invalidatedCaches(t, newInvalidator, keys...)
+	a.DeleteMatchingEntries(func(string) bool {
+		return true
+	})
+	synced(t, a, b)
+	if n := b.Len(); n != 0 {
+		t.Errorf("b.Len() = %d after DeleteMatchingEntries, want 0", n)
+	}
+
+	a, b = invalidatedCaches(t, newInvalidator, keys...)
+	a.Prune()
+	waitFor(t, func() bool {
+		return b.Len() == 0
+	})
+}
+
+func TestInvalidationBus(t *testing.T) {
+	bus := NewInvalidationBus()
+	testInvalidator(t, func() Invalidator {
+		return bus
+	})
+}
+
+// TestInvalidationBusReentrant publishes from an eviction callback handling a remote invalidation,
+// which must not block the publishing caches.
+func TestInvalidationBusReentrant(t *testing.T) {
+	bus := NewInvalidationBus()
+	a := New[string](WithInvalidator(bus))
+	var b *Cache[string]
+	b = New[string](WithInvalidator(bus), WithOnEvict(func(key, _ string, reason EvictReason) {
+		if reason == EvictDeleted {
+			b.Set("evicted:"+key, "", time.Hour)
+		}
+	}))
+	t.Cleanup(a.Close)
+	t.Cleanup(b.Close)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprint(i % 10)
+			a.Set(key, "a", time.Hour)
+			b.Set(key, "b", time.Hour)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sets still blocked on the invalidation bus after 5s")
+	}
+}
+
+func TestMulticastInvalidator(t *testing.T) {
+	ifi, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no loopback interface:", err)
+	}
+	probe, err := NewMulticastInvalidator("239.255.77.1:47999", ifi)
+	if err != nil {
+		t.Skip("multicast unavailable:", err)
+	}
+	probe.Close()
+
+	newInvalidator := func() *MulticastInvalidator {
+		m, err := NewMulticastInvalidator("239.255.77.1:47999", ifi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			m.Close()
+		})
+		return m
+	}
+	testInvalidator(t, func() Invalidator {
+		return newInvalidator()
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		m := newInvalidator()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		m.Publish(ctx, Invalidation{Kind: InvalidationAll})
+		<-ctx.Done()
+		if err := m.Publish(context.Background(), Invalidation{Kind: InvalidationAll}); err != nil {
+			t.Errorf("Publish() error = %v, the deadline of a previous context should not stick", err)
+		}
+	})
+
+	t.Run("close from handler", func(t *testing.T) {
+		a := New[string](WithInvalidator(newInvalidator()))
+		t.Cleanup(a.Close)
+		closed := make(chan struct{})
+		var b *Cache[string]
+		b = New[string](WithInvalidator(newInvalidator()), WithOnEvict(func(_, _ string, reason EvictReason) {
+			if reason == EvictDeleted {
+				b.Close()
+				close(closed)
+			}
+		}))
+		b.set(b.newEntry("key", "b", time.Hour, 0))
+
+		a.Delete("key")
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("closing the cache from a remote invalidation still blocked after 5s")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"iter"
+	"time"
+)
+
+// rangeChunk is the number of entries copied at once from a shard by Range.
+const rangeChunk = 256
+
+// item is a copy of a live entry handed out by the iteration methods.
+type item[K comparable, V any] struct {
+	key  K
+	data V
+	exp  time.Time
+}
+
+// Len returns the number of entries in the cache.
+// Expired entries not yet removed by the garbage collector are included.
+func (c *engine[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.locker.RLock()
+		n += s.count
+		s.locker.RUnlock()
+	}
+	return n
+}
+
+// Keys returns the keys of the live entries, in no particular order.
+func (c *engine[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	c.Range(func(key K, _ V, _ time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Range calls fn for each live entry with its key, value and expiration time until fn returns false.
+// The expiration time is zero for entries that never expire.
+// The entries are copied in chunks of rangeChunk and fn runs without holding any lock, so it may use
+// the cache; entries changed during the iteration may or may not be seen.
+// Range neither counts as an access for the eviction policy nor for the statistics.
+func (c *engine[K, V]) Range(fn func(key K, value V, exp time.Time) bool) {
+	for _, s := range c.shards {
+		if !s.walk(c.clock.Now(), fn) {
+			return
+		}
+	}
+}
+
+// All returns an iterator over the keys and values of the live entries, see Range.
+func (c *engine[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.Range(func(key K, value V, _ time.Time) bool {
+			return yield(key, value)
+		})
+	}
+}
+
+// walk calls fn for the entries of the shard alive at now until fn returns false, and reports whether
+// every entry was visited. At most rangeChunk entries, plus a collision chain, are copied under the
+// read lock before fn is called on them without it. The iteration of the map then resumes under the
+// lock, which the iteration semantics of maps allow even though it may have changed in the meantime.
+func (s *shard[K, V]) walk(now time.Time, fn func(key K, value V, exp time.Time) bool) bool {
+	chunk := make([]item[K, V], 0, rangeChunk)
+	flush := func() bool {
+		for _, it := range chunk {
+			if !fn(it.key, it.data, it.exp) {
+				return false
+			}
+		}
+		chunk = chunk[:0]
+		return true
+	}
+
+	s.locker.RLock()
+	for _, head := range s.items {
+		for entry := head; entry != nil; entry = entry.next {
+			if !entry.expired(now) {
+				chunk = append(chunk, item[K, V]{key: entry.key, data: entry.data, exp: entry.exp})
+			}
+		}
+		if len(chunk) >= rangeChunk {
+			s.locker.RUnlock()
+			if !flush() {
+				return false
+			}
+			s.locker.RLock()
+		}
+	}
+	s.locker.RUnlock()
+	return flush()
+}
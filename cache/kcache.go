@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"hash/maphash"
+	"runtime"
+	"unsafe"
+
+	"github.com/DmitriyVTitov/size"
+)
+
+// KCache is an in-memory cache keyed by any comparable type, e.g. integers or structs, which spares
+// formatting the keys into strings. It is the engine of Cache, with the same methods and options.
+//
+// The features built on string keys are left to Cache: namespaces, prefixes and invalidators.
+// NewKCache panics with WithPrefixIndex or WithInvalidator.
+type KCache[K comparable, V any] struct {
+	engine[K, V]
+}
+
+// keySize estimates the size of a key, including the memory it references.
+func keySize[K comparable](key K) uint64 {
+	return uint64(max(size.Of(key)-int(unsafe.Sizeof(key)), 0))
+}
+
+// NewKCache creates a new cache keyed by K with the provided options, see KCache.
+// The keys are hashed with maphash.Comparable and a random seed unless WithHasher is given.
+// It panics when the types of a generic option, e.g. WithOnEvict, do not match K and V.
+func NewKCache[K comparable, V any](options ...CacheOption) *KCache[K, V] {
+	o := newOptions(options)
+	if o.prefixIndex {
+		panic("cache: WithPrefixIndex requires a Cache")
+	}
+	if o.invalidator != nil {
+		panic("cache: WithInvalidator requires a Cache")
+	}
+
+	seed := maphash.MakeSeed()
+	c := new(KCache[K, V])
+	c.init(o, func(key K) uint64 {
+		return maphash.Comparable(seed, key)
+	}, func(key K, data V) uint64 {
+		return entryOverhead[K, V]() + keySize(key) + uint64(size.Of(data))
+	})
+	if c.janitor != nil {
+		runtime.SetFinalizer(c, func(c *KCache[K, V]) {
+			c.Close()
+		})
+	}
+	return c
+}
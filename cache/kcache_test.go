@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type point struct {
+	x, y int
+}
+
+func TestKCache(t *testing.T) {
+	c := NewKCache[int64, string](WithMaxEntries(2))
+	defer c.Close()
+
+	c.Set(1, "one", time.Minute)
+	c.Set(2, "two", NoExpiration)
+	if got, ok := c.Get(1); !ok || got != "one" {
+		t.Errorf("Get(1) = %q, %v, want one", got, ok)
+	}
+	c.Set(3, "three", time.Minute)
+	if _, ok := c.Peek(2); ok {
+		t.Error("2 is the least recently used entry and should have been evicted")
+	}
+	if ttl, ok := c.TTL(3); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL(3) = %v, %v", ttl, ok)
+	}
+
+	c.Delete(1)
+	if _, ok := c.Get(1); ok {
+		t.Error("1 was deleted")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+
+	c.Set(4, "four", -time.Second)
+	if _, ok := c.Get(4); ok {
+		t.Error("4 has expired")
+	}
+
+	st := c.Stats()
+	if st.Hits != 1 || st.Misses != 2 || st.Evictions != 1 || st.Deletions != 1 || st.Expirations != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	c.Prune()
+	if c.Len() != 0 || c.Size() != cacheMapSize {
+		t.Errorf("Prune left %d entries of size %d", c.Len(), c.Size())
+	}
+}
+
+func TestKCacheStructKeys(t *testing.T) {
+	// A constant hasher chains every key under the same hash.
+	c := NewKCache[point, int](WithHasher(func(point) uint64 { return 7 }), WithShards(4))
+	defer c.Close()
+
+	for i := range 10 {
+		c.Set(point{i, -i}, i, NoExpiration)
+	}
+	for i := range 10 {
+		if got, ok := c.Get(point{i, -i}); !ok || got != i {
+			t.Errorf("Get(%v) = %d, %v, want %d", point{i, -i}, got, ok, i)
+		}
+	}
+	if _, ok := c.Get(point{1, 1}); ok {
+		t.Error("{1 1} shares the hash but was never set")
+	}
+
+	c.Delete(point{3, -3})
+	sum := 0
+	for key, value := range c.All() {
+		if key.x != value {
+			t.Errorf("All yielded %v for %v", value, key)
+		}
+		sum += value
+	}
+	if sum != 45-3 {
+		t.Errorf("sum of the values = %d, want %d", sum, 45-3)
+	}
+}
+
+func TestKCacheOnEvict(t *testing.T) {
+	evicted := make(chan point, 1)
+	c := NewKCache[point, string](
+		WithMaxEntries(1),
+		WithOnEvict(func(key point, _ string, reason EvictReason) {
+			if reason == EvictCapacity {
+				evicted <- key
+			}
+		}),
+	)
+	defer c.Close()
+
+	c.Set(point{1, 2}, "a", NoExpiration)
+	c.Set(point{3, 4}, "b", NoExpiration)
+	if key := <-evicted; key != (point{1, 2}) {
+		t.Errorf("evicted %v, want {1 2}", key)
+	}
+}
+
+func TestKCacheGetOrLoad(t *testing.T) {
+	c := NewKCache[int, string]()
+	defer c.Close()
+
+	loads := 0
+	load := func(context.Context) (string, time.Duration, error) {
+		loads++
+		return "loaded", time.Minute, nil
+	}
+	for range 3 {
+		got, err := c.GetOrLoad(context.Background(), 42, load)
+		if err != nil || got != "loaded" {
+			t.Fatalf("GetOrLoad() = %q, %v", got, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loader called %d times, want 1", loads)
+	}
+}
+
+func TestKCacheAtomic(t *testing.T) {
+	c := NewKCache[point, int](WithoutGC())
+	defer c.Close()
+
+	if !c.SetIfAbsent(point{1, 1}, 1, time.Minute) || c.SetIfAbsent(point{1, 1}, 2, time.Minute) {
+		t.Error("SetIfAbsent should only set a missing key")
+	}
+	if !c.CompareAndSwap(point{1, 1}, 1, 10, nil) || c.CompareAndSwap(point{1, 1}, 1, 20, nil) {
+		t.Error("CompareAndSwap should only swap the current value")
+	}
+	c.Update(point{1, 1}, func(old int, _ bool) (int, bool) {
+		return old + 1, true
+	})
+	if got, _ := c.Get(point{1, 1}); got != 11 {
+		t.Errorf("Get() = %d after Update, want 11", got)
+	}
+	if ttl, _ := c.TTL(point{1, 1}); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL() = %v, the entry should keep its expiration", ttl)
+	}
+	if !c.Touch(point{1, 1}, NoExpiration) {
+		t.Error("Touch() should find the key")
+	}
+	if ttl, _ := c.TTL(point{1, 1}); ttl != NoExpiration {
+		t.Errorf("TTL() = %v after Touch, want NoExpiration", ttl)
+	}
+}
+
+func TestKCacheBatch(t *testing.T) {
+	c := NewKCache[int, string](WithShards(4), WithoutGC())
+	defer c.Close()
+
+	c.SetMany(map[int]string{1: "one", 2: "two", 3: "three"}, time.Minute)
+	c.SetWithTags(4, "four", time.Minute, "even")
+	c.DeleteMany([]int{2})
+	c.InvalidateTag("even")
+	got := c.GetMany([]int{1, 2, 3, 4})
+	if len(got) != 2 || got[1] != "one" || got[3] != "three" {
+		t.Errorf("GetMany() = %v, want 1 and 3", got)
+	}
+}
+
+func TestKCacheSnapshot(t *testing.T) {
+	c := NewKCache[int, string](WithoutGC())
+	defer c.Close()
+	c.Set(12, "a", time.Minute)
+	c.SetNoExpire(34, "b")
+
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+	restored := NewKCache[int, string](WithoutGC())
+	defer restored.Close()
+	if err := restored.LoadFrom(&buf); err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+	if got, _ := restored.Get(12); got != "a" {
+		t.Errorf("Get(12) = %q, want a", got)
+	}
+	if ttl, _ := restored.TTL(34); ttl != NoExpiration {
+		t.Errorf("TTL(34) = %v, want NoExpiration", ttl)
+	}
+}
+
+func TestKCacheStringOptions(t *testing.T) {
+	for name, option := range map[string]CacheOption{
+		"WithPrefixIndex": WithPrefixIndex(),
+		"WithInvalidator": WithInvalidator(NewInvalidationBus()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic, it requires string keys", name)
+				}
+			}()
+			NewKCache[int, string](option)
+		})
+	}
+}
+
+func TestKCacheOptionMismatch(t *testing.T) {
+	for name, option := range map[string]CacheOption{
+		"WithLoader": WithLoader(func(context.Context, string) (string, time.Duration, error) {
+			return "", 0, nil
+		}),
+		"WithOnEvict":          WithOnEvict(func(int, []byte, EvictReason) {}),
+		"WithSizer":            WithSizer(func(string, string) uint64 { return 0 }),
+		"WithHasher":           WithHasher(func(string) uint64 { return 0 }),
+		"WithExpirationPolicy": WithExpirationPolicy(func(int, int) time.Duration { return 0 }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of other types than int keys and string values should panic", name)
+				}
+			}()
+			NewKCache[int, string](option)
+		})
+	}
+}
+
+// BenchmarkKCache compares integer keys with the same keys formatted for a Cache.
+func BenchmarkKCache(b *testing.B) {
+	const n = 64 * 1000
+
+	b.Run("KCache", func(b *testing.B) {
+		c := NewKCache[int, int](WithMaxEntries(n))
+		defer c.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			key := i % n
+			c.Set(key, i, time.Minute)
+			c.Get(key)
+		}
+	})
+
+	b.Run("Cache", func(b *testing.B) {
+		c := New[int](WithMaxEntries(n))
+		defer c.Close()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			key := strconv.Itoa(i % n)
+			c.Set(key, i, time.Minute)
+			c.Get(key)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package cache
+
+import "container/list"
+
+// lfuBucket groups the keys sharing the same access frequency, the most recently used first.
+type lfuBucket struct {
+	freq uint64
+	keys *list.List
+}
+
+type lfuItem struct {
+	key    uint64
+	bucket *list.Element
+}
+
+// lfuQueue evicts the least frequently used key, ties are broken by recency.
+// Buckets are kept in ascending frequency order so that every operation runs in O(1).
+type lfuQueue struct {
+	buckets *list.List
+	items   map[uint64]*list.Element
+}
+
+// NewLFUPolicy returns a policy that evicts the least frequently used key.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuQueue{
+		buckets: list.New(),
+		items:   make(map[uint64]*list.Element),
+	}
+}
+
+func (q *lfuQueue) Add(key uint64) {
+	if _, ok := q.items[key]; ok {
+		q.Access(key)
+		return
+	}
+
+	front := q.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = q.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+
+	bucket := front.Value.(*lfuBucket)
+	q.items[key] = bucket.keys.PushFront(&lfuItem{key: key, bucket: front})
+}
+
+func (q *lfuQueue) Access(key uint64) {
+	elem, ok := q.items[key]
+	if !ok {
+		return
+	}
+
+	item := elem.Value.(*lfuItem)
+	current := item.bucket.Value.(*lfuBucket)
+	next := item.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != current.freq+1 {
+		next = q.buckets.InsertAfter(&lfuBucket{freq: current.freq + 1, keys: list.New()}, item.bucket)
+	}
+
+	q.unlink(elem)
+	item.bucket = next
+	q.items[key] = next.Value.(*lfuBucket).keys.PushFront(item)
+}
+
+func (q *lfuQueue) Remove(key uint64) {
+	elem, ok := q.items[key]
+	if !ok {
+		return
+	}
+
+	q.unlink(elem)
+	delete(q.items, key)
+}
+
+func (q *lfuQueue) Evict() (uint64, bool) {
+	front := q.buckets.Front()
+	if front == nil {
+		return 0, false
+	}
+
+	elem := front.Value.(*lfuBucket).keys.Back()
+	key := elem.Value.(*lfuItem).key
+	q.unlink(elem)
+	delete(q.items, key)
+	return key, true
+}
+
+// unlink removes the element from its bucket and drops the bucket once it is empty.
+func (q *lfuQueue) unlink(elem *list.Element) {
+	item := elem.Value.(*lfuItem)
+	bucket := item.bucket.Value.(*lfuBucket)
+	bucket.keys.Remove(elem)
+	if bucket.keys.Len() == 0 {
+		q.buckets.Remove(item.bucket)
+	}
+}
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrLoaderPanic is returned by GetOrLoad when the loader panicked, wrapped with the panic value and
+// the stack of the loader.
+var ErrLoaderPanic = errors.New("cache: loader panicked")
+
+// call is an in-flight load shared by every caller missing the same key.
+type call[T any] struct {
+	done chan struct{}
+	data T
+	err  error
+}
+
+// maxNegatives bounds the number of load failures remembered by a loadGroup.
+const maxNegatives = 4096
+
+// negativeEntry is a cached load failure.
+type negativeEntry struct {
+	err error
+	exp time.Time
+}
+
+// loadGroup coalesces concurrent loads of the same key and remembers recent failures.
+// Expired failures are removed by the garbage collector of the cache, see collectGarbage, and at most
+// maxNegatives failures are kept in any case.
+type loadGroup[K comparable, T any] struct {
+	clock     Clock
+	mu        sync.Mutex
+	calls     map[K]*call[T]
+	negatives map[K]negativeEntry
+}
+
+func newLoadGroup[K comparable, T any](clock Clock) *loadGroup[K, T] {
+	return &loadGroup[K, T]{
+		clock:     clock,
+		calls:     make(map[K]*call[T]),
+		negatives: make(map[K]negativeEntry),
+	}
+}
+
+// do runs fn once for all the concurrent callers of the same key and returns its result to each of them.
+// fn runs in its own goroutine with a context that is never canceled, so a caller giving up does not
+// fail the others; callers stop waiting as soon as their own context is done.
+// Failures are returned without calling fn again for the duration returned by negativeTTL, if positive.
+// A panic of fn is returned to the callers as an error wrapping ErrLoaderPanic.
+func (g *loadGroup[K, T]) do(ctx context.Context, key K, negativeTTL func(error) time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if negative, ok := g.negatives[key]; ok {
+		if g.clock.Now().Before(negative.exp) {
+			g.mu.Unlock()
+			return zero[T](), negative.err
+		}
+		delete(g.negatives, key)
+	}
+
+	cl, ok := g.calls[key]
+	if !ok {
+		cl = &call[T]{done: make(chan struct{})}
+		g.calls[key] = cl
+		go g.run(context.WithoutCancel(ctx), key, cl, negativeTTL, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.data, cl.err
+	case <-ctx.Done():
+		return zero[T](), ctx.Err()
+	}
+}
+
+func (g *loadGroup[K, T]) run(ctx context.Context, key K, cl *call[T], negativeTTL func(error) time.Duration, fn func(context.Context) (T, error)) {
+	cl.data, cl.err = protect(ctx, fn)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	if cl.err != nil && negativeTTL != nil {
+		if ttl := negativeTTL(cl.err); ttl > 0 {
+			now := g.clock.Now()
+			if len(g.negatives) >= maxNegatives {
+				g.shrink(now)
+			}
+			g.negatives[key] = negativeEntry{err: cl.err, exp: now.Add(ttl)}
+		}
+	}
+	g.mu.Unlock()
+
+	close(cl.done)
+}
+
+// protect calls fn, recovering from its panic since fn runs in a goroutine of the group where no caller
+// could recover from it.
+func protect[T any](ctx context.Context, fn func(context.Context) (T, error)) (data T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = zero[T](), fmt.Errorf("%w: %v\n%s", ErrLoaderPanic, r, debug.Stack())
+		}
+	}()
+	return fn(ctx)
+}
+
+// collectGarbage forgets the failures expired at now.
+func (g *loadGroup[K, T]) collectGarbage(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.removeExpired(now)
+}
+
+// removeExpired forgets the failures expired at now. The caller must hold the lock.
+func (g *loadGroup[K, T]) removeExpired(now time.Time) {
+	for key, negative := range g.negatives {
+		if !now.Before(negative.exp) {
+			delete(g.negatives, key)
+		}
+	}
+}
+
+// shrink makes room for new failures in a full group, forgetting the expired failures and then
+// arbitrary ones until a quarter of the room is free. The caller must hold the lock.
+func (g *loadGroup[K, T]) shrink(now time.Time) {
+	g.removeExpired(now)
+	for key := range g.negatives {
+		if len(g.negatives) < maxNegatives*3/4 {
+			break
+		}
+		delete(g.negatives, key)
+	}
+}
+
+// GetOrLoad returns the cached value of the key, loading it on a miss.
+// Concurrent misses for the same key share a single loader call and all receive its result or error.
+// A loaded value is cached with the expiration duration returned by the loader, errors are not cached
+// unless WithNegativeTTL is set. A panic of the loader is returned as an error wrapping ErrLoaderPanic.
+func (c *engine[K, V]) GetOrLoad(ctx context.Context, key K, loader func(context.Context) (V, time.Duration, error)) (V, error) {
+	return c.getOrLoad(ctx, key, loader, c.errorTTL)
+}
+
+// errorTTL returns how long GetOrLoad caches a loader error, see WithNegativeTTL.
+func (c *engine[K, V]) errorTTL(error) time.Duration {
+	return c.negativeTTL
+}
+
+// getOrLoad is GetOrLoad caching the loader errors for the duration returned by errorTTL.
+func (c *engine[K, V]) getOrLoad(ctx context.Context, key K, loader func(context.Context) (V, time.Duration, error), errorTTL func(error) time.Duration) (V, error) {
+	if data, ok := c.Get(key); ok {
+		return data, nil
+	}
+
+	return c.loads.do(ctx, key, errorTTL, func(ctx context.Context) (V, error) {
+		// Another load may have filled the key between the miss and this call.
+		if data, ok, _ := c.get(key); ok {
+			return data, nil
+		}
+
+		data, exp, err := loader(ctx)
+		if err != nil {
+			c.stats.loadFailures.Add(1)
+			return zero[V](), err
+		}
+
+		c.stats.loadSuccesses.Add(1)
+		c.set(c.newEntry(key, data, exp, c.sizer(key, data)))
+		return data, nil
+	})
+}
@@ -1,69 +1,118 @@
 package cache
 
-import "sync"
-
 type node struct {
-	value      string
+	key        uint64
 	prev, next *node
 }
 
+// lruQueue keeps the cache keys ordered from the most to the least recently used one.
+// Every node is indexed by its key so that all operations run in O(1).
+//
+// lruQueue is not safe for concurrent use, the caller must hold the cache lock.
 type lruQueue struct {
 	head, tail *node
-	size       int
-	mu         *sync.Mutex
+	nodes      map[uint64]*node
 }
 
-func (q *lruQueue) moveToFront(value string) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	n := &node{value, nil, nil}
+func newLRUQueue() *lruQueue {
+	return &lruQueue{
+		nodes: make(map[uint64]*node),
+	}
+}
 
-	if q.head == nil {
-		q.head = n
-		q.tail = n
+// len returns the number of keys in the queue.
+func (q *lruQueue) len() int {
+	return len(q.nodes)
+}
+
+// moveToFront marks the key as the most recently used one, inserting it if it is not in the queue yet.
+func (q *lruQueue) moveToFront(key uint64) {
+	n, ok := q.nodes[key]
+	if ok {
+		if n == q.head {
+			return
+		}
+		q.unlink(n)
 	} else {
-		n.next = q.head
-		q.head.prev = n
-		q.head = n
+		n = &node{key: key}
+		q.nodes[key] = n
 	}
 
-	q.size++
+	q.pushFront(n)
 }
 
-func (q *lruQueue) removeFromTail() string {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	if q.size == 0 {
-		return ""
+// remove drops the key from the queue, it is a no-op if the key is unknown.
+func (q *lruQueue) remove(key uint64) {
+	n, ok := q.nodes[key]
+	if !ok {
+		return
 	}
 
+	q.unlink(n)
+	delete(q.nodes, key)
+}
+
+// removeFromTail pops the least recently used key from the queue.
+func (q *lruQueue) removeFromTail() (uint64, bool) {
 	n := q.tail
-	value := n.value
+	if n == nil {
+		return 0, false
+	}
+
+	q.unlink(n)
+	delete(q.nodes, n.key)
+	return n.key, true
+}
+
+func (q *lruQueue) pushFront(n *node) {
+	n.prev = nil
+	n.next = q.head
+	if q.head != nil {
+		q.head.prev = n
+	}
+	q.head = n
+	if q.tail == nil {
+		q.tail = n
+	}
+}
 
-	if q.size == 1 {
-		q.head = nil
-		q.tail = nil
+func (q *lruQueue) unlink(n *node) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		q.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
 	} else {
 		q.tail = n.prev
-		q.tail.next = nil
-		n.prev = nil
 	}
+	n.prev, n.next = nil, nil
+}
+
+// contains reports whether the key is in the queue.
+func (q *lruQueue) contains(key uint64) bool {
+	_, ok := q.nodes[key]
+	return ok
+}
 
-	q.size--
-	return value
+// NewLRUPolicy returns a policy that evicts the least recently used key.
+func NewLRUPolicy() EvictionPolicy {
+	return newLRUQueue()
 }
 
-// evictLRU evicts the least recently used item from the cache.
-func (c *Cache[T]) evictLRU() {
-	key := c.lruList.removeFromTail()
+func (q *lruQueue) Add(key uint64) {
+	q.moveToFront(key)
+}
 
-	c.locker.Lock()
-	defer c.locker.Unlock()
-	item, ok := c.items[keyFromString(key)]
-	if !ok {
-		return
-	}
+func (q *lruQueue) Access(key uint64) {
+	q.moveToFront(key)
+}
+
+func (q *lruQueue) Remove(key uint64) {
+	q.remove(key)
+}
 
-	c.size -= item.size
-	delete(c.items, keyFromString(key))
+func (q *lruQueue) Evict() (uint64, bool) {
+	return q.removeFromTail()
 }
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type memoizeOptions struct {
+	keyFunc      any
+	ttl          time.Duration
+	errorPolicy  func(error) time.Duration
+	cacheOptions []CacheOption
+}
+
+type MemoizeOption interface {
+	apply(*memoizeOptions)
+}
+
+type keyFuncOption struct {
+	keyFunc any
+}
+
+func (o keyFuncOption) apply(opts *memoizeOptions) {
+	opts.keyFunc = o.keyFunc
+}
+
+// WithKeyFunc sets the function encoding the arguments of a memoized function into cache keys.
+// Distinct arguments must have distinct keys. K must match the argument type of the function,
+// or Memoize panics.
+func WithKeyFunc[K comparable](keyFunc func(K) string) MemoizeOption {
+	return keyFuncOption{keyFunc: keyFunc}
+}
+
+type ttlOption time.Duration
+
+func (o ttlOption) apply(opts *memoizeOptions) {
+	opts.ttl = time.Duration(o)
+}
+
+// WithTTL sets how long the results of a memoized function are cached, they never expire by default.
+func WithTTL(ttl time.Duration) MemoizeOption {
+	return ttlOption(ttl)
+}
+
+type errorPolicyOption func(error) time.Duration
+
+func (o errorPolicyOption) apply(opts *memoizeOptions) {
+	opts.errorPolicy = o
+}
+
+// WithErrorPolicy sets the function returning how long an error of a memoized function is cached,
+// errors returning zero are not. Errors are cached like WithNegativeTTL does by default.
+func WithErrorPolicy(policy func(error) time.Duration) MemoizeOption {
+	return errorPolicyOption(policy)
+}
+
+type cacheOptionsOption []CacheOption
+
+func (o cacheOptionsOption) apply(opts *memoizeOptions) {
+	opts.cacheOptions = append(opts.cacheOptions, o...)
+}
+
+// WithCacheOptions sets the options of the cache storing the results of a memoized function.
+func WithCacheOptions(options ...CacheOption) MemoizeOption {
+	return cacheOptionsOption(options)
+}
+
+// Memoize returns a function caching the results of fn by argument.
+// Concurrent calls missing the same argument share a single call of fn, which runs with a context
+// that is never canceled, see GetOrLoad.
+//
+// The arguments are the keys of a KCache, so that the cache options must suit one, unless they are
+// strings or WithKeyFunc is given, in which case the results are stored in a Cache.
+func Memoize[K comparable, V any](fn func(context.Context, K) (V, error), options ...MemoizeOption) func(context.Context, K) (V, error) {
+	o := memoizeOptions{ttl: NoExpiration}
+	for _, option := range options {
+		option.apply(&o)
+	}
+
+	if o.keyFunc != nil {
+		c := New[V](o.cacheOptions...)
+		return memoize(&c.engine, optionFunc[func(K) string]("WithKeyFunc", o.keyFunc), fn, o)
+	}
+	if _, ok := any((*K)(nil)).(*string); ok {
+		c := New[V](o.cacheOptions...)
+		return memoize(&c.engine, func(arg K) string {
+			return any(arg).(string)
+		}, fn, o)
+	}
+	c := NewKCache[K, V](o.cacheOptions...)
+	return memoize(&c.engine, func(arg K) K {
+		return arg
+	}, fn, o)
+}
+
+// memoize returns a function caching the results of fn in c, under the keys of their arguments.
+func memoize[K, C comparable, V any](c *engine[C, V], key func(K) C, fn func(context.Context, K) (V, error), o memoizeOptions) func(context.Context, K) (V, error) {
+	errorTTL := c.errorTTL
+	if o.errorPolicy != nil {
+		errorTTL = o.errorPolicy
+	}
+
+	return func(ctx context.Context, arg K) (V, error) {
+		return c.getOrLoad(ctx, key(arg), func(ctx context.Context) (V, time.Duration, error) {
+			data, err := fn(ctx, arg)
+			return data, o.ttl, err
+		}, errorTTL)
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// maxDatagramSize is the largest UDP payload over IPv4.
+const maxDatagramSize = 65507
+
+// MulticastInvalidator is an Invalidator broadcasting the invalidations as JSON datagrams to a
+// UDP multicast group, e.g. between the processes of a host through the loopback interface.
+// Delivery is best effort: invalidations may be lost or reordered.
+type MulticastInvalidator struct {
+	listener *net.UDPConn
+	// sendMu serializes the writes to sender with their deadline.
+	sendMu sync.Mutex
+	sender *net.UDPConn
+
+	mu       sync.RWMutex
+	handlers map[int]multicastHandler
+	next     int
+}
+
+// multicastHandler is a subscription to the invalidations of the other nodes than node.
+type multicastHandler struct {
+	node string
+	fn   func(Invalidation)
+}
+
+// NewMulticastInvalidator joins the multicast group, e.g. "239.255.77.1:47999", on the interface,
+// or the system default one when ifi is nil, and sends the invalidations through that interface.
+func NewMulticastInvalidator(group string, ifi *net.Interface) (*MulticastInvalidator, error) {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, fmt.Errorf("resolving group: %w", err)
+	}
+
+	listener, err := net.ListenMulticastUDP("udp4", ifi, addr)
+	if err != nil {
+		return nil, fmt.Errorf("joining group: %w", err)
+	}
+	sender, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("dialing group: %w", err)
+	}
+	if ifi != nil {
+		if err := setMulticastInterface(sender, ifi); err != nil {
+			listener.Close()
+			sender.Close()
+			return nil, fmt.Errorf("setting multicast interface: %w", err)
+		}
+	}
+
+	m := &MulticastInvalidator{
+		listener: listener,
+		sender:   sender,
+		handlers: make(map[int]multicastHandler),
+	}
+	go m.receive()
+	return m, nil
+}
+
+// Publish sends the invalidation to the group, split into several datagrams when its keys do not fit in one.
+func (m *MulticastInvalidator) Publish(ctx context.Context, inv Invalidation) error {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("encoding invalidation: %w", err)
+	}
+
+	if len(payload) > maxDatagramSize {
+		if len(inv.Keys) < 2 {
+			return fmt.Errorf("invalidation of %d bytes exceeds the datagram size", len(payload))
+		}
+		half := len(inv.Keys) / 2
+		first, second := inv, inv
+		first.Keys, second.Keys = inv.Keys[:half], inv.Keys[half:]
+		if err := m.Publish(ctx, first); err != nil {
+			return err
+		}
+		return m.Publish(ctx, second)
+	}
+
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+	// Without a deadline the context clears the one of a previous Publish.
+	deadline, _ := ctx.Deadline()
+	if err := m.sender.SetWriteDeadline(deadline); err != nil {
+		return fmt.Errorf("setting write deadline: %w", err)
+	}
+	if _, err := m.sender.Write(payload); err != nil {
+		return fmt.Errorf("sending invalidation: %w", err)
+	}
+	return nil
+}
+
+func (m *MulticastInvalidator) Subscribe(node string, fn func(Invalidation)) (cancel func()) {
+	m.mu.Lock()
+	id := m.next
+	m.next++
+	m.handlers[id] = multicastHandler{node: node, fn: fn}
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		delete(m.handlers, id)
+		m.mu.Unlock()
+	}
+}
+
+// Close leaves the group and stops receiving invalidations.
+func (m *MulticastInvalidator) Close() error {
+	return errors.Join(m.listener.Close(), m.sender.Close())
+}
+
+// receive calls the handlers with the invalidations received from the group until the listener is closed.
+// Malformed datagrams are ignored. The handlers are called without the lock, so that they may unsubscribe,
+// e.g. by closing their cache from an eviction callback.
+func (m *MulticastInvalidator) receive() {
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := m.listener.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+
+		var inv Invalidation
+		if err := json.Unmarshal(buffer[:n], &inv); err != nil {
+			continue
+		}
+		m.mu.RLock()
+		handlers := make([]multicastHandler, 0, len(m.handlers))
+		for _, h := range m.handlers {
+			if h.node != inv.Node {
+				handlers = append(handlers, h)
+			}
+		}
+		m.mu.RUnlock()
+		for _, h := range handlers {
+			h.fn(inv)
+		}
+	}
+}
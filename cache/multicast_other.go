@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package cache
+
+import "net"
+
+// setMulticastInterface is a no-op on this platform, datagrams are sent through the default multicast route.
+func setMulticastInterface(conn *net.UDPConn, ifi *net.Interface) error {
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package cache
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setMulticastInterface makes the connection send its multicast datagrams through the interface,
+// which is needed for interfaces without a multicast route such as the loopback one.
+func setMulticastInterface(conn *net.UDPConn, ifi *net.Interface) error {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return err
+	}
+
+	var ip [4]byte
+	found := false
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			copy(ip[:], ipNet.IP.To4())
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("interface %s has no IPv4 address", ifi.Name)
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, ip)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
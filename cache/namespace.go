@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespaceSeparator separates the name of a namespace from the keys of its entries.
+const namespaceSeparator = ':'
+
+// namespace accounts for the entries whose key starts with its name and the separator.
+type namespace struct {
+	stats stats
+
+	mu    sync.Mutex
+	quota uint64
+	// lru orders the hashes of the entries of the namespace to enforce its quota.
+	lru   *lruQueue
+	size  uint64
+	count int
+}
+
+// add accounts for an entry stored in its shard, the caller must hold the shard lock.
+func (ns *namespace) add(hashKey, size uint64) {
+	ns.stats.sets.Add(1)
+	ns.mu.Lock()
+	ns.lru.moveToFront(hashKey)
+	ns.size += size
+	ns.count++
+	ns.mu.Unlock()
+}
+
+// access marks the entry as the most recently used one of the namespace, the caller must hold the shard lock.
+func (ns *namespace) access(hashKey uint64) {
+	ns.mu.Lock()
+	if ns.lru.contains(hashKey) {
+		ns.lru.moveToFront(hashKey)
+	}
+	ns.mu.Unlock()
+}
+
+// remove accounts for an entry removed from its shard, the caller must hold the shard lock.
+func (ns *namespace) remove(hashKey, size uint64) {
+	ns.mu.Lock()
+	ns.lru.remove(hashKey)
+	ns.size -= size
+	ns.count--
+	ns.mu.Unlock()
+}
+
+type namespaceOptions struct {
+	quota uint64
+}
+
+type NamespaceOption interface {
+	apply(*namespaceOptions)
+}
+
+type quotaOption uint64
+
+func (o quotaOption) apply(opts *namespaceOptions) {
+	opts.quota = uint64(o)
+}
+
+// WithQuota bounds the size of the entries of a namespace, evicting its least recently used entries
+// when it is exceeded. A zero quota leaves the namespace bounded by the cache capacity only.
+func WithQuota(size uint64) NamespaceOption {
+	return quotaOption(size)
+}
+
+// Namespace is a view of the entries of a cache whose key starts with the name of the namespace
+// followed by a colon, so that several modules can share a cache without their keys colliding.
+type Namespace[T any] struct {
+	cache  *Cache[T]
+	ns     *namespace
+	name   string
+	prefix string
+}
+
+// Namespace returns the view of the namespace with the given name, which must not contain a colon.
+// Views of the same name share their statistics and quota, which is changed by the options.
+// Only the entries set once the namespace is created are accounted in its statistics and quota,
+// whether they are set through the view or the cache.
+func (c *Cache[T]) Namespace(name string, options ...NamespaceOption) *Namespace[T] {
+	if strings.IndexByte(name, namespaceSeparator) >= 0 {
+		panic(fmt.Sprintf("cache: namespace name %q contains %q", name, namespaceSeparator))
+	}
+
+	value, _ := c.namespaces.LoadOrStore(name, &namespace{lru: newLRUQueue()})
+	ns := value.(*namespace)
+	c.hasNamespaces.Store(true)
+	if len(options) > 0 {
+		var o namespaceOptions
+		for _, option := range options {
+			option.apply(&o)
+		}
+		ns.mu.Lock()
+		ns.quota = o.quota
+		ns.mu.Unlock()
+		c.enforceQuota(ns)
+	}
+
+	return &Namespace[T]{
+		cache:  c,
+		ns:     ns,
+		name:   name,
+		prefix: name + string(namespaceSeparator),
+	}
+}
+
+// PruneNamespace removes every entry of the namespace with the given name.
+func (c *Cache[T]) PruneNamespace(name string) {
+	prefix := name + string(namespaceSeparator)
+	c.deleteByPrefix(prefix, EvictPruned)
+	c.publish(Invalidation{Kind: InvalidationPrefix, Prefix: prefix})
+}
+
+// namespaceOf returns the namespace accounting for the key, or nil.
+// Only a Cache has namespaces, so the key is a string once there is one.
+func (c *engine[K, V]) namespaceOf(key K) *namespace {
+	if !c.hasNamespaces.Load() {
+		return nil
+	}
+
+	name := any(key).(string)
+	i := strings.IndexByte(name, namespaceSeparator)
+	if i < 0 {
+		return nil
+	}
+	value, ok := c.namespaces.Load(name[:i])
+	if !ok {
+		return nil
+	}
+	return value.(*namespace)
+}
+
+// lookedUp counts a lookup of the key in the statistics of its namespace, if any.
+func (c *engine[K, V]) lookedUp(key K, hit bool) {
+	ns := c.namespaceOf(key)
+	if ns == nil {
+		return
+	}
+
+	if hit {
+		ns.stats.hits.Add(1)
+	} else {
+		ns.stats.misses.Add(1)
+	}
+}
+
+// enforceQuota evicts the least recently used entries of the namespace until it fits its quota.
+// It must be called without holding any shard lock.
+func (c *engine[K, V]) enforceQuota(ns *namespace) {
+	if ns == nil {
+		return
+	}
+
+	for {
+		ns.mu.Lock()
+		if ns.quota == 0 || ns.size <= ns.quota {
+			ns.mu.Unlock()
+			return
+		}
+		hashKey, ok := ns.lru.removeFromTail()
+		ns.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		s := c.shard(hashKey)
+		s.locker.Lock()
+		for entry := s.items[hashKey]; entry != nil; entry = entry.next {
+			if entry.ns == ns {
+				s.delete(hashKey, entry.key, EvictCapacity)
+			}
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+}
+
+// Name returns the name of the namespace.
+func (n *Namespace[T]) Name() string {
+	return n.name
+}
+
+// Get retrieves the value of the key in the namespace, see Cache.Get.
+func (n *Namespace[T]) Get(key string) (T, bool) {
+	return n.cache.Get(n.prefix + key)
+}
+
+// Set sets the value of the key in the namespace, see Cache.Set.
+func (n *Namespace[T]) Set(key string, data T, exp time.Duration) {
+	n.cache.Set(n.prefix+key, data, exp)
+}
+
+// Delete removes the key from the namespace.
+func (n *Namespace[T]) Delete(key string) {
+	n.cache.Delete(n.prefix + key)
+}
+
+// GetOrLoad returns the value of the key in the namespace, loading it on a miss, see Cache.GetOrLoad.
+func (n *Namespace[T]) GetOrLoad(ctx context.Context, key string, loader func(context.Context) (T, time.Duration, error)) (T, error) {
+	return n.cache.GetOrLoad(ctx, n.prefix+key, loader)
+}
+
+// Prune removes every entry of the namespace, see Cache.PruneNamespace.
+func (n *Namespace[T]) Prune() {
+	n.cache.PruneNamespace(n.name)
+}
+
+// Stats returns a snapshot of the statistics of the namespace.
+// Loads are only counted in the statistics of the cache.
+func (n *Namespace[T]) Stats() Stats {
+	st := n.ns.stats.snapshot()
+	n.ns.mu.Lock()
+	st.Entries = n.ns.count
+	st.Size = n.ns.size
+	n.ns.mu.Unlock()
+	return st
+}
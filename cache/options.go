@@ -1,7 +1,43 @@
 package cache
 
+import (
+	"context"
+	"time"
+)
+
 type Options struct {
 	capacity uint64
+	policy   func() EvictionPolicy
+	shards   int
+
+	negativeTTL time.Duration
+
+	loader       any
+	staleTTL     time.Duration
+	refreshAhead float64
+
+	onEvict any
+
+	codec Codec
+
+	gcInterval time.Duration
+
+	sizer      any
+	maxEntries int
+
+	sliding bool
+
+	prefixIndex bool
+
+	invalidator Invalidator
+
+	hasher any
+
+	clock Clock
+
+	defaultTTL       time.Duration
+	ttlJitter        float64
+	expirationPolicy any
 }
 
 type CacheOption interface {
@@ -14,6 +50,272 @@ func (o capacityOption) apply(opts *Options) {
 	opts.capacity = uint64(o)
 }
 
+// WithCapacity bounds the size of the cache in bytes, see WithSizer.
+// The cache defaults to 12.5% of the memory obtained from the OS, capped at 200 MB,
+// unless it is bounded by WithMaxEntries.
 func WithCapacity(o uint64) CacheOption {
 	return capacityOption(o)
 }
+
+type evictionPolicyOption func() EvictionPolicy
+
+func (o evictionPolicyOption) apply(opts *Options) {
+	opts.policy = o
+}
+
+// WithEvictionPolicy sets the constructor of the eviction policy used by the cache, e.g. NewLFUPolicy.
+// The cache defaults to NewLRUPolicy.
+func WithEvictionPolicy(newPolicy func() EvictionPolicy) CacheOption {
+	return evictionPolicyOption(newPolicy)
+}
+
+type shardsOption int
+
+func (o shardsOption) apply(opts *Options) {
+	opts.shards = int(o)
+}
+
+// WithShards partitions the cache into independently locked shards, rounded up to a power of two.
+// The capacity is split evenly between the shards. The cache defaults to a single shard.
+func WithShards(n int) CacheOption {
+	return shardsOption(n)
+}
+
+type negativeTTLOption time.Duration
+
+func (o negativeTTLOption) apply(opts *Options) {
+	opts.negativeTTL = time.Duration(o)
+}
+
+// WithNegativeTTL makes GetOrLoad cache loader errors for the given duration.
+// Errors are not cached by default.
+func WithNegativeTTL(ttl time.Duration) CacheOption {
+	return negativeTTLOption(ttl)
+}
+
+type loaderOption struct {
+	loader any
+}
+
+func (o loaderOption) apply(opts *Options) {
+	opts.loader = o.loader
+}
+
+// WithLoader registers the loader used to refresh entries in the background,
+// see WithStaleWhileRevalidate and WithRefreshAhead. K and T must match the key and value types of
+// the cache, K being string for a Cache, or New and NewKCache panic.
+func WithLoader[K comparable, T any](loader func(ctx context.Context, key K) (T, time.Duration, error)) CacheOption {
+	return loaderOption{loader: loader}
+}
+
+type staleTTLOption time.Duration
+
+func (o staleTTLOption) apply(opts *Options) {
+	opts.staleTTL = time.Duration(o)
+}
+
+// WithStaleWhileRevalidate keeps serving expired entries for the given duration while the
+// registered loader refreshes them. It has no effect without WithLoader.
+func WithStaleWhileRevalidate(stale time.Duration) CacheOption {
+	return staleTTLOption(stale)
+}
+
+type refreshAheadOption float64
+
+func (o refreshAheadOption) apply(opts *Options) {
+	opts.refreshAhead = float64(o)
+}
+
+// WithRefreshAhead reloads entries hit during the last fraction of their lifetime, e.g. 0.2 refreshes
+// entries read in the last 20% of their TTL before they expire. It has no effect without WithLoader.
+func WithRefreshAhead(fraction float64) CacheOption {
+	return refreshAheadOption(fraction)
+}
+
+type onEvictOption struct {
+	fn any
+}
+
+func (o onEvictOption) apply(opts *Options) {
+	opts.onEvict = o.fn
+}
+
+// WithOnEvict registers a callback invoked whenever an entry leaves the cache, with the reason why.
+// The callback runs outside the cache lock and may use the cache. K and V must match the key and value
+// types of the cache, K being string for a Cache, or New and NewKCache panic.
+func WithOnEvict[K comparable, V any](fn func(key K, value V, reason EvictReason)) CacheOption {
+	return onEvictOption{fn: fn}
+}
+
+type codecOption struct {
+	codec Codec
+}
+
+func (o codecOption) apply(opts *Options) {
+	opts.codec = o.codec
+}
+
+// WithCodec sets the codec used to persist the cache values. The cache defaults to GobCodec.
+func WithCodec(codec Codec) CacheOption {
+	return codecOption{codec: codec}
+}
+
+type gcIntervalOption time.Duration
+
+func (o gcIntervalOption) apply(opts *Options) {
+	opts.gcInterval = time.Duration(o)
+}
+
+// WithGCInterval sets how often expired entries are removed in the background, every 2 minutes by default.
+// A non-positive interval disables the background removal.
+func WithGCInterval(interval time.Duration) CacheOption {
+	return gcIntervalOption(interval)
+}
+
+// WithoutGC disables the background removal of expired entries, they are then only removed when read.
+func WithoutGC() CacheOption {
+	return gcIntervalOption(0)
+}
+
+type sizerOption struct {
+	sizer any
+}
+
+func (o sizerOption) apply(opts *Options) {
+	opts.sizer = o.sizer
+}
+
+// WithSizer sets the function computing the size accounted for an entry against the capacity.
+// It replaces the default estimation, which measures the data by reflection and adds the memory
+// used by the cache to index the entry. K and V must match the key and value types of the cache,
+// K being string for a Cache, or New and NewKCache panic.
+func WithSizer[K comparable, V any](sizer func(key K, value V) uint64) CacheOption {
+	return sizerOption{sizer: sizer}
+}
+
+type maxEntriesOption int
+
+func (o maxEntriesOption) apply(opts *Options) {
+	opts.maxEntries = int(o)
+}
+
+// WithMaxEntries bounds the number of entries, split evenly between the shards.
+// Without WithCapacity, the size of the cache is then left unbounded.
+func WithMaxEntries(n int) CacheOption {
+	return maxEntriesOption(n)
+}
+
+type slidingExpirationOption bool
+
+func (o slidingExpirationOption) apply(opts *Options) {
+	opts.sliding = bool(o)
+}
+
+// WithSlidingExpiration restarts the expiration duration of an entry each time Get returns it.
+func WithSlidingExpiration() CacheOption {
+	return slidingExpirationOption(true)
+}
+
+type prefixIndexOption bool
+
+func (o prefixIndexOption) apply(opts *Options) {
+	opts.prefixIndex = bool(o)
+}
+
+// WithPrefixIndex indexes the keys in a trie so that DeleteByPrefix only visits the matching keys
+// instead of scanning the whole cache, at the cost of slower sets and memory not accounted in Size.
+func WithPrefixIndex() CacheOption {
+	return prefixIndexOption(true)
+}
+
+type invalidatorOption struct {
+	Invalidator
+}
+
+func (o invalidatorOption) apply(opts *Options) {
+	opts.invalidator = o.Invalidator
+}
+
+// WithInvalidator shares the invalidations of the cache with the other caches subscribed to the
+// invalidator, e.g. the replicas of a service. Sets and removals are published, loads and snapshot
+// restores are not. The cache subscribes until it is closed.
+func WithInvalidator(invalidator Invalidator) CacheOption {
+	return invalidatorOption{invalidator}
+}
+
+type hasherOption struct {
+	hasher any
+}
+
+func (o hasherOption) apply(opts *Options) {
+	opts.hasher = o.hasher
+}
+
+// WithHasher sets the function hashing the keys, which defaults to FNV-1a for a Cache and to
+// maphash.Comparable with a random seed for a KCache. Keys with equal hashes are still told apart,
+// so the hasher only affects how evenly the keys are spread. K must match the key type of the cache,
+// K being string for a Cache, or New and NewKCache panic.
+func WithHasher[K comparable](hasher func(key K) uint64) CacheOption {
+	return hasherOption{hasher: hasher}
+}
+
+type clockOption struct {
+	Clock
+}
+
+func (o clockOption) apply(opts *Options) {
+	opts.clock = o.Clock
+}
+
+// WithClock sets the clock used to expire the entries and to schedule the garbage collection,
+// see WithGCInterval. The cache defaults to SystemClock.
+func WithClock(clock Clock) CacheOption {
+	return clockOption{clock}
+}
+
+type defaultTTLOption time.Duration
+
+func (o defaultTTLOption) apply(opts *Options) {
+	opts.defaultTTL = time.Duration(o)
+}
+
+// WithDefaultTTL sets the expiration duration of the entries set with DefaultExpiration, e.g. by
+// SetDefault. The cache defaults to NoExpiration.
+func WithDefaultTTL(ttl time.Duration) CacheOption {
+	return defaultTTLOption(ttl)
+}
+
+type ttlJitterOption float64
+
+func (o ttlJitterOption) apply(opts *Options) {
+	opts.ttlJitter = float64(o)
+}
+
+// WithTTLJitter shortens the expiration duration of each entry by a random amount up to the given
+// fraction of it, e.g. 0.1 makes an entry set for 10 minutes expire between 9 and 10 minutes later.
+// It spreads the expirations of entries set together, so that they are not all reloaded at once.
+// Entries are never kept longer than their expiration duration.
+func WithTTLJitter(fraction float64) CacheOption {
+	return ttlJitterOption(fraction)
+}
+
+// ExpirationPolicy computes the expiration duration of an entry from its key and value, e.g. from the
+// expiration time of a token. It may return NoExpiration, any other duration that is not positive
+// expires the entry immediately, e.g. for a token that has already expired.
+type ExpirationPolicy[K comparable, V any] func(key K, value V) time.Duration
+
+type expirationPolicyOption struct {
+	policy any
+}
+
+func (o expirationPolicyOption) apply(opts *Options) {
+	opts.expirationPolicy = o.policy
+}
+
+// WithExpirationPolicy sets the policy computing the expiration duration of the entries set with
+// DefaultExpiration, in place of the default TTL. The policy may run under the lock of a shard and
+// must not use the cache. K and V must match the key and value types of the cache, K being string
+// for a Cache, or New and NewKCache panic.
+func WithExpirationPolicy[K comparable, V any](policy ExpirationPolicy[K, V]) CacheOption {
+	return expirationPolicyOption{policy: policy}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	snapshotMagic = "NQCACHE"
+	// snapshotVersion 2 added the lifetime of the entries, version 1 snapshots are still loaded.
+	snapshotVersion = 2
+	// maxSnapshotRecord bounds the length of an encoded entry read from a snapshot.
+	maxSnapshotRecord = 1 << 30
+)
+
+var (
+	// ErrSnapshotFormat is returned when loading data that is not a cache snapshot.
+	ErrSnapshotFormat = errors.New("cache: not a cache snapshot")
+	// ErrSnapshotVersion is returned when loading a snapshot written in an unsupported format version.
+	ErrSnapshotVersion = errors.New("cache: unsupported snapshot version")
+)
+
+// snapshotHeader starts every snapshot, SavedAt lets the loader age the TTLs.
+type snapshotHeader struct {
+	Magic   [len(snapshotMagic)]byte
+	Version uint8
+	SavedAt int64
+}
+
+// snapshotRecord is a persisted entry with its remaining lifetime at save time, or NoExpiration.
+// The lifetime excludes the stale window of the saving cache, which may be negative for a stale entry,
+// see WithStaleWhileRevalidate. Lifetime is the expiration duration the entry was set with, which a
+// sliding expiration restarts, see WithSlidingExpiration.
+type snapshotRecord[K comparable, V any] struct {
+	Key      K
+	Value    V
+	TTL      time.Duration
+	Tags     []string
+	Lifetime time.Duration
+}
+
+// SaveTo writes the live entries to w with the configured codec, see WithCodec.
+// The entries of each shard are written from the least to the most recently used one
+// so that loading them back restores their recency.
+func (c *engine[K, V]) SaveTo(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := snapshotHeader{Version: snapshotVersion, SavedAt: c.clock.Now().UnixNano()}
+	copy(header.Magic[:], snapshotMagic)
+	if err := binary.Write(bw, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	now := time.Unix(0, header.SavedAt)
+	var length [binary.MaxVarintLen64]byte
+	for _, s := range c.shards {
+		for _, record := range s.records(now, c.staleWindow()) {
+			data, err := c.codec.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("encoding entry %v: %w", record.Key, err)
+			}
+			n := binary.PutUvarint(length[:], uint64(len(data)))
+			if _, err := bw.Write(length[:n]); err != nil {
+				return fmt.Errorf("writing entry %v: %w", record.Key, err)
+			}
+			if _, err := bw.Write(data); err != nil {
+				return fmt.Errorf("writing entry %v: %w", record.Key, err)
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing entries: %w", err)
+	}
+	return nil
+}
+
+// records returns the entries of the shard alive at now, ordered by last access.
+// The lifetimes of the records exclude the stale window of the entries.
+func (s *shard[K, V]) records(now time.Time, stale time.Duration) []snapshotRecord[K, V] {
+	type accessed struct {
+		access uint64
+		index  int
+	}
+
+	s.locker.RLock()
+	records := make([]snapshotRecord[K, V], 0, s.count)
+	order := make([]accessed, 0, s.count)
+	for _, head := range s.items {
+		for entry := head; entry != nil; entry = entry.next {
+			if entry.expired(now) {
+				continue
+			}
+			ttl := NoExpiration
+			if !entry.exp.IsZero() {
+				ttl = entry.exp.Sub(now) - stale
+			}
+			order = append(order, accessed{access: entry.access, index: len(records)})
+			records = append(records, snapshotRecord[K, V]{Key: entry.key, Value: entry.data, TTL: ttl, Tags: entry.tags, Lifetime: entry.ttl})
+		}
+	}
+	s.locker.RUnlock()
+
+	slices.SortFunc(order, func(a, b accessed) int {
+		return cmp.Compare(a.access, b.access)
+	})
+	sorted := make([]snapshotRecord[K, V], len(records))
+	for i, o := range order {
+		sorted[i] = records[o.index]
+	}
+	return sorted
+}
+
+// LoadFrom reads a snapshot written by SaveTo and sets its entries, skipping the ones
+// that expired since the snapshot was saved. Stale entries are kept for the stale window of the cache.
+func (c *engine[K, V]) LoadFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var header snapshotHeader
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrSnapshotFormat
+		}
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if string(header.Magic[:]) != snapshotMagic {
+		return ErrSnapshotFormat
+	}
+	if header.Version < 1 || header.Version > snapshotVersion {
+		return fmt.Errorf("%w %d", ErrSnapshotVersion, header.Version)
+	}
+
+	age := c.clock.Now().Sub(time.Unix(0, header.SavedAt))
+	for {
+		length, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: truncated entry length", ErrSnapshotFormat)
+		}
+		if err != nil {
+			return fmt.Errorf("reading entry: %w", err)
+		}
+		if length > maxSnapshotRecord {
+			return fmt.Errorf("%w: entry of %d bytes", ErrSnapshotFormat, length)
+		}
+
+		// The entry is read as it comes rather than allocated upfront, the length may be corrupted.
+		var data bytes.Buffer
+		if _, err := data.ReadFrom(io.LimitReader(br, int64(length))); err != nil {
+			return fmt.Errorf("reading entry: %w", err)
+		}
+		if uint64(data.Len()) != length {
+			return fmt.Errorf("%w: truncated entry", ErrSnapshotFormat)
+		}
+		var record snapshotRecord[K, V]
+		if err := c.codec.Unmarshal(data.Bytes(), &record); err != nil {
+			return fmt.Errorf("decoding entry: %w", err)
+		}
+
+		entry := c.newTaggedEntry(record.Key, record.Value, NoExpiration, record.Tags)
+		if record.TTL != NoExpiration {
+			ttl := record.TTL - age
+			if ttl+c.staleWindow() <= 0 {
+				continue
+			}
+			// The remaining lifetime was resolved when the entry was set, it is restored as is.
+			entry.ttl = record.Lifetime
+			if header.Version < 2 {
+				entry.ttl = ttl
+			}
+			entry.exp, entry.refresh = c.expiration(c.clock.Now(), ttl)
+		}
+		c.set(entry)
+	}
+}
+
+// SaveToFile writes a snapshot of the cache to the file, see SaveTo.
+func (c *engine[K, V]) SaveToFile(fp string) error {
+	file, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	if err := c.SaveTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile loads a snapshot written by SaveToFile, see LoadFrom.
+func (c *engine[K, V]) LoadFromFile(fp string) error {
+	file, err := os.OpenFile(fp, os.O_RDONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	return c.LoadFrom(file)
+}
@@ -0,0 +1,16 @@
+package cache
+
+// EvictionPolicy decides which key leaves the cache once it runs out of capacity.
+// Keys are the hashes produced by keyFromString.
+//
+// The cache calls the policy while holding its lock, implementations need not be safe for concurrent use.
+type EvictionPolicy interface {
+	// Add records a key that has just been inserted into the cache.
+	Add(key uint64)
+	// Access records a hit or an overwrite of a key already in the cache.
+	Access(key uint64)
+	// Remove forgets a key that has been deleted from the cache.
+	Remove(key uint64)
+	// Evict picks the next victim and forgets it, it returns false when no key is tracked.
+	Evict() (uint64, bool)
+}
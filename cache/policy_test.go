@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var policies = []struct {
+	name      string
+	newPolicy func() EvictionPolicy
+}{
+	{"LRU", NewLRUPolicy},
+	{"LFU", NewLFUPolicy},
+	{"FIFO", NewFIFOPolicy},
+	{"ARC", NewARCPolicy},
+	{"TinyLFU", NewTinyLFUPolicy},
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	for _, tt := range policies {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.newPolicy()
+			tracked := make(map[uint64]bool)
+			for key := uint64(0); key < 1000; key++ {
+				p.Add(key)
+				tracked[key] = true
+				if key%3 == 0 && tracked[key/2] {
+					p.Access(key / 2)
+				}
+				if key%7 == 0 {
+					p.Remove(key)
+					delete(tracked, key)
+				}
+			}
+
+			for len(tracked) > 0 {
+				key, ok := p.Evict()
+				if !ok {
+					t.Fatalf("Evict() returned no key while %d keys are tracked", len(tracked))
+				}
+				if !tracked[key] {
+					t.Fatalf("Evict() returned %d which is not tracked", key)
+				}
+				delete(tracked, key)
+			}
+
+			if key, ok := p.Evict(); ok {
+				t.Errorf("Evict() = %d on an empty policy", key)
+			}
+		})
+	}
+}
+
+func TestEvictionPolicyOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		newPolicy func() EvictionPolicy
+		want      uint64
+	}{
+		// 1 is the least recently used key after the hit on 0.
+		{"LRU", NewLRUPolicy, 1},
+		// 0 was inserted first, the hit does not matter.
+		{"FIFO", NewFIFOPolicy, 0},
+		// 0 and 2 have been hit, 1 is the only key used once.
+		{"LFU", NewLFUPolicy, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.newPolicy()
+			p.Add(0)
+			p.Add(1)
+			p.Add(2)
+			p.Access(2)
+			p.Access(0)
+			if got, _ := p.Evict(); got != tt.want {
+				t.Errorf("Evict() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheWithEvictionPolicy(t *testing.T) {
+	entry := entrySize("a", "value")
+	c := New[string](WithCapacity(cacheMapSize+3*entry), WithEvictionPolicy(NewLFUPolicy))
+
+	c.Set("a", "value", time.Minute)
+	c.Set("b", "value", time.Minute)
+	c.Set("c", "value", time.Minute)
+	c.Get("a")
+	c.Get("b")
+	c.Get("a")
+
+	c.Set("d", "value", time.Minute)
+	if _, ok := c.Get("c"); ok {
+		t.Error("c is the least frequently used entry and should have been evicted")
+	}
+}
+
+// BenchmarkPolicyHitRatio replays Zipf distributed traces against a cache holding 1% of the keys
+// and reports the hit ratio of every policy.
+func BenchmarkPolicyHitRatio(b *testing.B) {
+	const (
+		keySpace = 100 * 1000
+		entries  = keySpace / 100
+	)
+
+	for _, s := range []float64{1.01, 1.2} {
+		rng := rand.New(rand.NewSource(1))
+		zipf := rand.NewZipf(rng, s, 1, keySpace-1)
+		trace := make([]string, 1000*1000)
+		for i := range trace {
+			trace[i] = fmt.Sprintf("%08d", zipf.Uint64())
+		}
+
+		for _, tt := range policies {
+			b.Run(fmt.Sprintf("zipf=%.2f/%s", s, tt.name), func(b *testing.B) {
+				capacity := cacheMapSize + entries*entrySize(trace[0], trace[0])
+				c := New[string](WithCapacity(capacity), WithEvictionPolicy(tt.newPolicy))
+
+				var hits int
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					key := trace[i%len(trace)]
+					if _, ok := c.Get(key); ok {
+						hits++
+						continue
+					}
+					c.Set(key, key, time.Hour)
+				}
+				b.ReportMetric(100*float64(hits)/float64(b.N), "hit%")
+			})
+		}
+	}
+}
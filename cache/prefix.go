@@ -0,0 +1,94 @@
+package cache
+
+// prefixNode is a node of a prefixTrie, count is the number of keys below it, itself included.
+type prefixNode struct {
+	children map[byte]*prefixNode
+	count    int
+	leaf     bool
+}
+
+// prefixTrie indexes keys byte by byte to list the keys starting with a prefix
+// without visiting the other ones.
+//
+// prefixTrie is not safe for concurrent use, the caller must hold the shard lock.
+type prefixTrie struct {
+	root prefixNode
+}
+
+func newPrefixTrie() *prefixTrie {
+	return &prefixTrie{}
+}
+
+// find returns the node of the key, or nil if no indexed key starts with it.
+func (t *prefixTrie) find(key string) *prefixNode {
+	n := &t.root
+	for i := 0; i < len(key) && n != nil; i++ {
+		n = n.children[key[i]]
+	}
+	return n
+}
+
+// insert adds the key to the trie, it is a no-op if the key is already indexed.
+func (t *prefixTrie) insert(key string) {
+	if n := t.find(key); n != nil && n.leaf {
+		return
+	}
+
+	n := &t.root
+	n.count++
+	for i := 0; i < len(key); i++ {
+		child, ok := n.children[key[i]]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[byte]*prefixNode)
+			}
+			child = &prefixNode{}
+			n.children[key[i]] = child
+		}
+		child.count++
+		n = child
+	}
+	n.leaf = true
+}
+
+// remove drops the key from the trie along with the nodes left without keys.
+// It is a no-op if the key is unknown.
+func (t *prefixTrie) remove(key string) {
+	if n := t.find(key); n == nil || !n.leaf {
+		return
+	}
+
+	n := &t.root
+	n.count--
+	for i := 0; i < len(key); i++ {
+		child := n.children[key[i]]
+		child.count--
+		if child.count == 0 {
+			delete(n.children, key[i])
+			return
+		}
+		n = child
+	}
+	n.leaf = false
+}
+
+// keys returns the indexed keys starting with the prefix.
+func (t *prefixTrie) keys(prefix string) []string {
+	n := t.find(prefix)
+	if n == nil || n.count == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, n.count)
+	var walk func(n *prefixNode, key []byte)
+	walk = func(n *prefixNode, key []byte) {
+		if n.leaf {
+			keys = append(keys, string(key))
+		}
+		for b, child := range n.children {
+			walk(child, append(key, b))
+		}
+	}
+	walk(n, []byte(prefix))
+	return keys
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// newEntry creates the entry of the key expiring after exp and accounted for the given size.
+// DefaultExpiration is resolved by the expiration policy or the default TTL, then the TTL jitter applies.
+func (c *engine[K, V]) newEntry(key K, data V, exp time.Duration, size uint64) *CacheEntry[K, V] {
+	exp = c.jitter(resolveTTL(c.expirationPolicy, key, data, exp, c.defaultTTL))
+	entry := &CacheEntry[K, V]{
+		key:   key,
+		hash:  c.hasher(key),
+		data:  data,
+		ttl:   exp,
+		size:  size,
+		index: -1,
+		ns:    c.namespaceOf(key),
+	}
+	entry.exp, entry.refresh = c.expiration(c.clock.Now(), exp)
+	return entry
+}
+
+// resolveTTL returns exp, or for DefaultExpiration the duration computed by the expiration policy if
+// any, else the default TTL. The result of the policy is used as is, the entry expiring immediately
+// unless it is positive or NoExpiration.
+func resolveTTL[K comparable, V any](policy func(K, V) time.Duration, key K, data V, exp, defaultTTL time.Duration) time.Duration {
+	switch {
+	case exp != DefaultExpiration:
+		return exp
+	case policy != nil:
+		return policy(key, data)
+	default:
+		return defaultTTL
+	}
+}
+
+// jitter shortens the positive ttl by a random fraction of it, see WithTTLJitter.
+func (o *Options) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || o.ttlJitter <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*min(o.ttlJitter, 1)*float64(ttl))
+}
+
+// expiration returns the expiration and refresh times of an entry living ttl from now,
+// both are zero with NoExpiration. With a registered loader, the entry stays servable for the
+// stale duration past ttl and is due for a refresh once ttl, or the refresh-ahead point before it,
+// is reached.
+func (c *engine[K, V]) expiration(now time.Time, ttl time.Duration) (exp, refresh time.Time) {
+	if ttl == NoExpiration {
+		return time.Time{}, time.Time{}
+	}
+
+	exp = now.Add(ttl)
+	if c.loader == nil {
+		return exp, time.Time{}
+	}
+
+	switch {
+	case c.refreshAhead > 0 && c.refreshAhead < 1:
+		refresh = now.Add(time.Duration(float64(ttl) * (1 - c.refreshAhead)))
+	case c.staleTTL > 0:
+		refresh = exp
+	}
+	if c.staleTTL > 0 {
+		exp = exp.Add(c.staleTTL)
+	}
+	return exp, refresh
+}
+
+// staleWindow returns how long entries stay servable past their TTL, see WithStaleWhileRevalidate.
+func (c *engine[K, V]) staleWindow() time.Duration {
+	if c.loader == nil {
+		return 0
+	}
+	return c.staleTTL
+}
+
+// refresh reloads the key in the background with the registered loader.
+// Concurrent refreshes and GetOrLoad calls of the same key share the load.
+func (c *engine[K, V]) refresh(key K) {
+	go c.loads.do(context.Background(), key, nil, func(ctx context.Context) (V, error) {
+		data, exp, err := c.loader(ctx, key)
+		if err != nil {
+			c.stats.loadFailures.Add(1)
+			return zero[V](), err
+		}
+
+		c.stats.loadSuccesses.Add(1)
+		c.set(c.newEntry(key, data, exp, c.sizer(key, data)))
+		return data, nil
+	})
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shard is an independently locked partition of the cache with its own capacity and eviction policy.
+type shard[K comparable, V any] struct {
+	items  map[uint64]*CacheEntry[K, V]
+	locker *sync.RWMutex
+
+	policy   EvictionPolicy
+	size     uint64
+	count    int
+	capacity uint64
+	// maxEntries bounds the number of entries when positive.
+	maxEntries int
+	stats      *stats
+	// tick orders the entries by last access, it is used to persist the recency of entries.
+	tick uint64
+	// expiries orders the entries by expiration time for the garbage collector.
+	expiries expiryHeap[K, V]
+	// tags indexes the entries by tag, prefixes indexes the keys when enabled by WithPrefixIndex,
+	// which is only supported by string keys.
+	tags     map[string]map[*CacheEntry[K, V]]struct{}
+	prefixes *prefixTrie
+
+	// onEvict is the eviction callback, removals are recorded only when it is set.
+	onEvict  func(K, V, EvictReason)
+	removals []removal[K, V]
+	pending  atomic.Bool
+}
+
+func newShard[K comparable, V any](capacity uint64, policy EvictionPolicy, stats *stats, onEvict func(K, V, EvictReason)) *shard[K, V] {
+	return &shard[K, V]{
+		items:    make(map[uint64]*CacheEntry[K, V]),
+		tags:     make(map[string]map[*CacheEntry[K, V]]struct{}),
+		locker:   new(sync.RWMutex),
+		policy:   policy,
+		size:     cacheMapSize,
+		capacity: capacity,
+		stats:    stats,
+		onEvict:  onEvict,
+	}
+}
+
+// get returns the entry stored under the key, walking the collision chain of its hash.
+// The caller must hold the lock.
+func (s *shard[K, V]) get(hashKey uint64, key K) *CacheEntry[K, V] {
+	for entry := s.items[hashKey]; entry != nil; entry = entry.next {
+		if entry.key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// set stores the entry, replacing any entry with the same key in the collision chain,
+// and records its hash in the eviction policy. The caller must hold the lock.
+func (s *shard[K, V]) set(entry *CacheEntry[K, V]) {
+	head, ok := s.items[entry.hash]
+	if ok {
+		s.policy.Access(entry.hash)
+	} else {
+		s.policy.Add(entry.hash)
+	}
+
+	entry.next = head
+	for prev := entry; prev.next != nil; prev = prev.next {
+		if old := prev.next; old.key == entry.key {
+			prev.next = old.next
+			s.release(old, EvictReplaced)
+			break
+		}
+	}
+
+	s.items[entry.hash] = entry
+	s.size += entry.size
+	s.count++
+	s.touch(entry)
+	s.index(entry)
+	if !entry.exp.IsZero() {
+		heap.Push(&s.expiries, entry)
+	}
+}
+
+// release accounts for an entry unlinked from the shard, the caller must hold the lock.
+func (s *shard[K, V]) release(entry *CacheEntry[K, V], reason EvictReason) {
+	s.size -= entry.size
+	s.count--
+	if entry.index >= 0 {
+		heap.Remove(&s.expiries, entry.index)
+	}
+	s.unindex(entry)
+	s.removed(entry, reason)
+}
+
+// expire changes the expiration and refresh times of the entry, the caller must hold the lock.
+func (s *shard[K, V]) expire(entry *CacheEntry[K, V], exp, refresh time.Time) {
+	entry.exp, entry.refresh = exp, refresh
+	switch {
+	case entry.index >= 0 && exp.IsZero():
+		heap.Remove(&s.expiries, entry.index)
+	case entry.index >= 0:
+		heap.Fix(&s.expiries, entry.index)
+	case !exp.IsZero():
+		heap.Push(&s.expiries, entry)
+	}
+}
+
+// full reports whether the shard exceeds its capacity or its maximum number of entries.
+// The caller must hold the lock.
+func (s *shard[K, V]) full() bool {
+	return s.size > s.capacity || (s.maxEntries > 0 && s.count > s.maxEntries)
+}
+
+// touch marks the entry as the most recently accessed one of the shard, the caller must hold the lock.
+func (s *shard[K, V]) touch(entry *CacheEntry[K, V]) {
+	s.tick++
+	entry.access = s.tick
+}
+
+// evict removes the entries chosen by the eviction policy.
+// The policy tracks hashes, so every entry of a collision chain leaves the cache together.
+// It reports whether an entry was evicted, the caller must hold the lock.
+func (s *shard[K, V]) evict() bool {
+	hashKey, ok := s.policy.Evict()
+	if !ok {
+		return false
+	}
+
+	for entry := s.items[hashKey]; entry != nil; entry = entry.next {
+		s.release(entry, EvictCapacity)
+	}
+	delete(s.items, hashKey)
+	return true
+}
+
+// delete removes the entry stored under the key for the given reason and forgets its hash
+// in the eviction policy once the collision chain is empty. The caller must hold the lock.
+func (s *shard[K, V]) delete(hashKey uint64, key K, reason EvictReason) {
+	var prev *CacheEntry[K, V]
+	for entry := s.items[hashKey]; entry != nil; prev, entry = entry, entry.next {
+		if entry.key != key {
+			continue
+		}
+
+		s.release(entry, reason)
+		switch {
+		case prev != nil:
+			prev.next = entry.next
+		case entry.next != nil:
+			s.items[hashKey] = entry.next
+		default:
+			delete(s.items, hashKey)
+			s.policy.Remove(hashKey)
+		}
+		return
+	}
+}
+
+// prune removes every entry of the shard and replaces its eviction policy.
+// The entries are visited to report them when there is an eviction callback or namespaces to account them in.
+// The caller must hold the lock.
+func (s *shard[K, V]) prune(policy EvictionPolicy, namespaced bool) {
+	if s.onEvict != nil || namespaced {
+		for _, head := range s.items {
+			for entry := head; entry != nil; entry = entry.next {
+				if entry.ns != nil {
+					entry.ns.remove(entry.hash, entry.size)
+				}
+				s.removed(entry, EvictPruned)
+			}
+		}
+	} else {
+		s.stats.removals[EvictPruned].Add(uint64(s.count))
+	}
+
+	s.items = make(map[uint64]*CacheEntry[K, V])
+	s.tags = make(map[string]map[*CacheEntry[K, V]]struct{})
+	if s.prefixes != nil {
+		s.prefixes = newPrefixTrie()
+	}
+	s.policy = policy
+	s.size = cacheMapSize
+	s.count = 0
+	s.expiries = nil
+}
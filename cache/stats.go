@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// stats holds the counters of a cache, updated atomically.
+type stats struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	sets          atomic.Uint64
+	removals      [EvictReplaced + 1]atomic.Uint64
+	loadSuccesses atomic.Uint64
+	loadFailures  atomic.Uint64
+}
+
+// Stats is a snapshot of the cache statistics.
+type Stats struct {
+	Hits          uint64
+	Misses        uint64
+	Sets          uint64
+	Evictions     uint64 // entries removed to make room
+	Expirations   uint64
+	Deletions     uint64
+	Prunes        uint64
+	Replacements  uint64
+	LoadSuccesses uint64
+	LoadFailures  uint64
+	HitRatio      float64
+	Entries       int
+	Size          uint64
+}
+
+// snapshot returns the counters, without the entries and size.
+func (s *stats) snapshot() Stats {
+	st := Stats{
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Sets:          s.sets.Load(),
+		Evictions:     s.removals[EvictCapacity].Load(),
+		Expirations:   s.removals[EvictExpired].Load(),
+		Deletions:     s.removals[EvictDeleted].Load(),
+		Prunes:        s.removals[EvictPruned].Load(),
+		Replacements:  s.removals[EvictReplaced].Load(),
+		LoadSuccesses: s.loadSuccesses.Load(),
+		LoadFailures:  s.loadFailures.Load(),
+	}
+	if lookups := st.Hits + st.Misses; lookups > 0 {
+		st.HitRatio = float64(st.Hits) / float64(lookups)
+	}
+	return st
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *engine[K, V]) Stats() Stats {
+	st := c.stats.snapshot()
+	for _, s := range c.shards {
+		s.locker.RLock()
+		st.Entries += s.count
+		st.Size += s.size
+		s.locker.RUnlock()
+	}
+	return st
+}
+
+// PublishExpvar exposes the cache statistics as an expvar variable with the given name.
+// Like expvar.Publish, it panics if the name is already registered.
+func (c *engine[K, V]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return c.Stats()
+	}))
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// tagSize is the memory used by the tag index for each tag of an entry besides the tag itself:
+// the string header in the entry and the slot of the entry in the tag set.
+const tagSize = 16 + mapSlotSize
+
+// tagsSize returns the memory used to tag an entry with the tags.
+func tagsSize(tags []string) uint64 {
+	if len(tags) == 0 {
+		return 0
+	}
+
+	total := uint64(24)
+	for _, tag := range tags {
+		total += tagSize + uint64(len(tag))
+	}
+	return total
+}
+
+// SetWithTags is like Set but tags the entry so that it can be removed with InvalidateTag.
+// The memory of the tag index is accounted in the size of the entry.
+func (c *engine[K, V]) SetWithTags(key K, data V, exp time.Duration, tags ...string) {
+	c.set(c.newTaggedEntry(key, data, exp, tags))
+	c.publishKeys(key)
+}
+
+// newTaggedEntry creates the entry of the key like newEntry, tagged with the distinct tags.
+func (c *engine[K, V]) newTaggedEntry(key K, data V, exp time.Duration, tags []string) *CacheEntry[K, V] {
+	if len(tags) > 0 {
+		tags = slices.Clone(tags)
+		slices.Sort(tags)
+		tags = slices.Compact(tags)
+	}
+
+	entry := c.newEntry(key, data, exp, c.sizer(key, data)+tagsSize(tags))
+	entry.tags = tags
+	return entry
+}
+
+// InvalidateTag removes every entry tagged with the tag by SetWithTags.
+func (c *engine[K, V]) InvalidateTag(tag string) {
+	c.invalidateTag(tag)
+	c.publish(Invalidation{Kind: InvalidationTag, Tag: tag})
+}
+
+func (c *engine[K, V]) invalidateTag(tag string) {
+	for _, s := range c.shards {
+		s.locker.Lock()
+		for entry := range s.tags[tag] {
+			s.delete(entry.hash, entry.key, EvictDeleted)
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+}
+
+// DeleteByPrefix removes every entry whose key starts with the prefix.
+// Without WithPrefixIndex, every key of the cache is visited.
+func (c *Cache[T]) DeleteByPrefix(prefix string) {
+	c.deleteByPrefix(prefix, EvictDeleted)
+	c.publish(Invalidation{Kind: InvalidationPrefix, Prefix: prefix})
+}
+
+func (c *Cache[T]) deleteByPrefix(prefix string, reason EvictReason) {
+	for _, s := range c.shards {
+		s.locker.Lock()
+		if s.prefixes != nil {
+			for _, key := range s.prefixes.keys(prefix) {
+				s.delete(c.hasher(key), key, reason)
+			}
+		} else {
+			for hashKey, head := range s.items {
+				for entry := head; entry != nil; entry = entry.next {
+					if strings.HasPrefix(entry.key, prefix) {
+						s.delete(hashKey, entry.key, reason)
+					}
+				}
+			}
+		}
+		s.locker.Unlock()
+		s.notify()
+	}
+}
+
+// index adds the entry to the secondary indexes of the shard, the caller must hold the lock.
+func (s *shard[K, V]) index(entry *CacheEntry[K, V]) {
+	for _, tag := range entry.tags {
+		entries, ok := s.tags[tag]
+		if !ok {
+			entries = make(map[*CacheEntry[K, V]]struct{})
+			s.tags[tag] = entries
+		}
+		entries[entry] = struct{}{}
+	}
+	if s.prefixes != nil {
+		s.prefixes.insert(any(entry.key).(string))
+	}
+	if entry.ns != nil {
+		entry.ns.add(entry.hash, entry.size)
+	}
+}
+
+// unindex removes the entry from the secondary indexes of the shard, the caller must hold the lock.
+func (s *shard[K, V]) unindex(entry *CacheEntry[K, V]) {
+	for _, tag := range entry.tags {
+		entries := s.tags[tag]
+		delete(entries, entry)
+		if len(entries) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+	if s.prefixes != nil {
+		s.prefixes.remove(any(entry.key).(string))
+	}
+	if entry.ns != nil {
+		entry.ns.remove(entry.hash, entry.size)
+	}
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by a write-behind Tiered cache written after Close.
+var ErrClosed = errors.New("cache: tiered cache closed")
+
+// WriteMode tells when a Tiered cache writes to its backend.
+type WriteMode int
+
+const (
+	// WriteThrough writes to the backend before the write returns.
+	WriteThrough WriteMode = iota
+	// WriteBehind queues the writes to the backend, which are applied in order by a goroutine.
+	WriteBehind
+)
+
+type tieredOptions struct {
+	mode      WriteMode
+	queueSize int
+	l1TTL     time.Duration
+	onError   func(key string, err error)
+}
+
+type TieredOption interface {
+	apply(*tieredOptions)
+}
+
+type writeBehindOption int
+
+func (o writeBehindOption) apply(opts *tieredOptions) {
+	opts.mode = WriteBehind
+	opts.queueSize = int(o)
+}
+
+// WithWriteBehind makes the writes return once the first level is updated, queueing up to
+// queueSize writes to the backend. Writes block while the queue is full.
+func WithWriteBehind(queueSize int) TieredOption {
+	return writeBehindOption(queueSize)
+}
+
+type l1TTLOption time.Duration
+
+func (o l1TTLOption) apply(opts *tieredOptions) {
+	opts.l1TTL = time.Duration(o)
+}
+
+// WithL1TTL bounds how long the first level keeps a value, so that the writes of other
+// processes sharing the backend are eventually seen.
+func WithL1TTL(ttl time.Duration) TieredOption {
+	return l1TTLOption(ttl)
+}
+
+type writeErrorOption func(key string, err error)
+
+func (o writeErrorOption) apply(opts *tieredOptions) {
+	opts.onError = o
+}
+
+// WithWriteErrorHandler sets the function called with the errors of the queued writes to the backend.
+// Those errors are dropped by default.
+func WithWriteErrorHandler(fn func(key string, err error)) TieredOption {
+	return writeErrorOption(fn)
+}
+
+// tieredWrite is a write queued for the backend, or a flush marker when flushed is set.
+type tieredWrite struct {
+	ctx     context.Context
+	key     string
+	value   []byte
+	exp     time.Duration
+	delete  bool
+	flushed chan struct{}
+}
+
+// Tiered layers a Cache, the first level, over a Backend, the second level.
+// Values are encoded for the backend with the codec of the cache, see WithCodec.
+// A miss in the first level is loaded from the backend and filled in the first level.
+type Tiered[T any] struct {
+	l1 *Cache[T]
+	l2 Backend
+	tieredOptions
+
+	mu     sync.RWMutex
+	closed bool
+	writes chan tieredWrite
+	done   chan struct{}
+}
+
+// NewTiered creates a two-level cache over l1 and l2, writing through by default.
+// A write-behind cache must be closed to flush its queued writes.
+func NewTiered[T any](l1 *Cache[T], l2 Backend, options ...TieredOption) *Tiered[T] {
+	t := &Tiered[T]{l1: l1, l2: l2}
+	for _, option := range options {
+		option.apply(&t.tieredOptions)
+	}
+	if t.mode == WriteBehind {
+		t.writes = make(chan tieredWrite, max(t.queueSize, 0))
+		t.done = make(chan struct{})
+		go t.write(t.writes)
+	}
+	return t
+}
+
+// Get returns the value of the key from the first level, or loads it from the backend.
+// Concurrent misses for the same key share a single backend call, see GetOrLoad.
+// It returns ErrNotFound when the key is in neither level.
+func (t *Tiered[T]) Get(ctx context.Context, key string) (T, error) {
+	return t.l1.GetOrLoad(ctx, key, func(ctx context.Context) (T, time.Duration, error) {
+		value, exp, err := t.l2.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			return zero[T](), 0, err
+		}
+		if err != nil {
+			return zero[T](), 0, fmt.Errorf("reading backend: %w", err)
+		}
+
+		var data T
+		if err := t.l1.codec.Unmarshal(value, &data); err != nil {
+			return zero[T](), 0, fmt.Errorf("decoding value: %w", err)
+		}
+		return data, t.l1Expiration(exp), nil
+	})
+}
+
+// Set stores the value of the key in both levels for the expiration duration.
+// Writing through, the first level is only updated once the backend is, and the key is removed
+// from the first level when the backend fails.
+func (t *Tiered[T]) Set(ctx context.Context, key string, data T, exp time.Duration) error {
+	// Both levels use the expiration resolved by the first one, the backend has no default TTL.
+	exp = resolveTTL(t.l1.expirationPolicy, key, data, exp, t.l1.defaultTTL)
+	value, err := t.l1.codec.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding value: %w", err)
+	}
+
+	if t.mode == WriteBehind {
+		t.l1.Set(key, data, t.l1Expiration(exp))
+		return t.enqueue(ctx, tieredWrite{key: key, value: value, exp: exp})
+	}
+
+	if err := t.l2.Set(ctx, key, value, exp); err != nil {
+		t.l1.Delete(key)
+		return fmt.Errorf("writing backend: %w", err)
+	}
+	t.l1.Set(key, data, t.l1Expiration(exp))
+	return nil
+}
+
+// Delete removes the key from both levels.
+func (t *Tiered[T]) Delete(ctx context.Context, key string) error {
+	t.l1.Delete(key)
+	if t.mode == WriteBehind {
+		return t.enqueue(ctx, tieredWrite{key: key, delete: true})
+	}
+
+	if err := t.l2.Delete(ctx, key); err != nil {
+		return fmt.Errorf("deleting from backend: %w", err)
+	}
+	return nil
+}
+
+// Flush waits until the writes queued before the call are applied to the backend.
+// It returns immediately when writing through.
+func (t *Tiered[T]) Flush(ctx context.Context) error {
+	if t.mode != WriteBehind {
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	if err := t.enqueue(ctx, tieredWrite{flushed: flushed}); err != nil {
+		return err
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close applies the queued writes to the backend and stops the write-behind goroutine.
+// Later writes return ErrClosed. The first level cache is left open. Close is idempotent.
+func (t *Tiered[T]) Close() {
+	if t.mode != WriteBehind {
+		return
+	}
+
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.writes)
+	}
+	t.mu.Unlock()
+	<-t.done
+}
+
+// l1Expiration returns the expiration duration of a value in the first level, bounded by WithL1TTL.
+func (t *Tiered[T]) l1Expiration(exp time.Duration) time.Duration {
+	if t.l1TTL > 0 && (exp == NoExpiration || exp > t.l1TTL) {
+		return t.l1TTL
+	}
+	return exp
+}
+
+// enqueue queues the write for the backend, waiting for room in the queue until ctx is done.
+// The write runs with ctx, which is no longer canceled once the call returns.
+func (t *Tiered[T]) enqueue(ctx context.Context, w tieredWrite) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return ErrClosed
+	}
+
+	w.ctx = context.WithoutCancel(ctx)
+	select {
+	case t.writes <- w:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write applies the queued writes to the backend until the queue is closed.
+func (t *Tiered[T]) write(writes <-chan tieredWrite) {
+	defer close(t.done)
+	for w := range writes {
+		var err error
+		switch {
+		case w.flushed != nil:
+			close(w.flushed)
+			continue
+		case w.delete:
+			err = t.l2.Delete(w.ctx, w.key)
+		default:
+			err = t.l2.Set(w.ctx, w.key, w.value, w.exp)
+		}
+		if err != nil && t.onError != nil {
+			t.onError(w.key, err)
+		}
+	}
+}
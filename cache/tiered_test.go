@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackends(t *testing.T) {
+	fileBackend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, backend := range map[string]Backend{"memory": NewMemoryBackend(), "file": fileBackend} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, _, err := backend.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(missing) error = %v, want %v", err, ErrNotFound)
+			}
+
+			if err := backend.Set(ctx, "forever", []byte("value"), NoExpiration); err != nil {
+				t.Fatal(err)
+			}
+			value, exp, err := backend.Get(ctx, "forever")
+			if err != nil || string(value) != "value" || exp != NoExpiration {
+				t.Errorf("Get(forever) = %q, %v, %v", value, exp, err)
+			}
+
+			if err := backend.Set(ctx, "a/key with spaces", []byte("other"), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			value, exp, err = backend.Get(ctx, "a/key with spaces")
+			if err != nil || string(value) != "other" || exp <= 0 || exp > time.Hour {
+				t.Errorf("Get(a/key with spaces) = %q, %v, %v", value, exp, err)
+			}
+
+			if err := backend.Set(ctx, "expired", []byte("value"), time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			if _, _, err := backend.Get(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(expired) error = %v, want %v", err, ErrNotFound)
+			}
+
+			if err := backend.Delete(ctx, "forever"); err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.Delete(ctx, "forever"); err != nil {
+				t.Errorf("deleting a missing key: %v", err)
+			}
+			if _, _, err := backend.Get(ctx, "forever"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(forever) error = %v after Delete, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+// countingBackend counts the reads of the wrapped backend.
+type countingBackend struct {
+	Backend
+	mu    sync.Mutex
+	reads int
+}
+
+func (b *countingBackend) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	b.mu.Lock()
+	b.reads++
+	b.mu.Unlock()
+	return b.Backend.Get(ctx, key)
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingBackend{Backend: NewMemoryBackend()}
+	writer := NewTiered(New[string](), backend)
+	if err := writer.Set(ctx, "key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := backend.Backend.Get(ctx, "key"); err != nil {
+		t.Errorf("value not written through: %v", err)
+	}
+	if data, err := writer.Get(ctx, "key"); err != nil || data != "value" || backend.reads != 0 {
+		t.Errorf("Get() = %q, %v with %d backend reads, want a first level hit", data, err, backend.reads)
+	}
+
+	l1 := New[string]()
+	reader := NewTiered(l1, backend, WithL1TTL(time.Minute))
+	for i := 0; i < 2; i++ {
+		if data, err := reader.Get(ctx, "key"); err != nil || data != "value" {
+			t.Errorf("Get() = %q, %v, want value", data, err)
+		}
+	}
+	if backend.reads != 1 {
+		t.Errorf("%d backend reads, want the first level to be filled", backend.reads)
+	}
+	if ttl, ok := l1.TTL("key"); !ok || ttl > time.Minute {
+		t.Errorf("first level TTL() = %v, %v, want at most a minute", ttl, ok)
+	}
+
+	if _, err := reader.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want %v", err, ErrNotFound)
+	}
+
+	if err := reader.Delete(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v after Delete, want %v", err, ErrNotFound)
+	}
+}
+
+// failingBackend fails every write.
+type failingBackend struct {
+	Backend
+}
+
+func (failingBackend) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("backend down")
+}
+
+func TestTieredWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	l1 := New[string]()
+	l1.Set("key", "stale", time.Hour)
+
+	tiered := NewTiered(l1, failingBackend{NewMemoryBackend()})
+	if err := tiered.Set(ctx, "key", "value", time.Hour); err == nil {
+		t.Error("Set() should fail with the backend")
+	}
+	if _, ok := l1.Get("key"); ok {
+		t.Error("the first level should not keep a value the backend failed to store")
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	tiered = NewTiered(l1, failingBackend{NewMemoryBackend()}, WithWriteBehind(1), WithWriteErrorHandler(func(key string, err error) {
+		mu.Lock()
+		failed = append(failed, key)
+		mu.Unlock()
+	}))
+	if err := tiered.Set(ctx, "key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	tiered.Close()
+	if len(failed) != 1 || failed[0] != "key" {
+		t.Errorf("write errors reported for %v, want [key]", failed)
+	}
+	if err := tiered.Set(ctx, "key", "value", time.Hour); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set() error = %v after Close, want %v", err, ErrClosed)
+	}
+}
+
+func TestTieredWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	tiered := NewTiered(New[int](WithCodec(JSONCodec{})), backend, WithWriteBehind(16))
+	defer tiered.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := tiered.Set(ctx, "counter", i, NoExpiration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := tiered.Get(ctx, "counter"); err != nil || data != 99 {
+		t.Errorf("Get() = %d, %v, want 99 from the first level", data, err)
+	}
+	if err := tiered.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := backend.Get(ctx, "counter"); err != nil || string(value) != "99" {
+		t.Errorf("backend value = %q, %v after Flush, want the last write", value, err)
+	}
+
+	if err := tiered.Delete(ctx, "counter"); err != nil {
+		t.Fatal(err)
+	}
+	tiered.Close()
+	if _, _, err := backend.Get(ctx, "counter"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("backend Get() error = %v after Close, want the delete to be applied", err)
+	}
+}
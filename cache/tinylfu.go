@@ -0,0 +1,178 @@
+package cache
+
+const (
+	tinyLFUWindowRatio    = 100 // the admission window holds 1% of the keys
+	tinyLFUProtectedRatio = 0.8 // the protected segment holds 80% of the main space
+	minSketchWidth        = 64
+	sketchDepth           = 4
+	sketchMaxCount        = 15
+)
+
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// countMinSketch estimates key frequencies with 4-bit saturating counters.
+// Once the number of increments reaches ten times its width, all the counters are halved so
+// that old popularity fades away.
+type countMinSketch struct {
+	table     []uint8
+	mask      uint64
+	additions int
+}
+
+func newCountMinSketch(width int) *countMinSketch {
+	width = nextPowerOfTwo(max(width, minSketchWidth))
+	return &countMinSketch{
+		table: make([]uint8, width*sketchDepth),
+		mask:  uint64(width - 1),
+	}
+}
+
+func (s *countMinSketch) width() int {
+	return int(s.mask + 1)
+}
+
+func (s *countMinSketch) index(key uint64, row int) int {
+	h := (key ^ sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	h ^= h >> 32
+	return row*s.width() + int(h&s.mask)
+}
+
+func (s *countMinSketch) increment(key uint64) {
+	for row := 0; row < sketchDepth; row++ {
+		i := s.index(key, row)
+		if s.table[i] < sketchMaxCount {
+			s.table[i]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= 10*s.width() {
+		for i := range s.table {
+			s.table[i] >>= 1
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key uint64) uint8 {
+	count := uint8(sketchMaxCount)
+	for row := 0; row < sketchDepth; row++ {
+		count = min(count, s.table[s.index(key, row)])
+	}
+	return count
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// tinyLFUQueue implements the W-TinyLFU policy.
+//
+// New keys enter a small LRU window. Until the cache evicts for the first time, keys overflowing
+// the window move straight to the main space. Afterwards, when the cache must evict while the
+// window is over its share, the window's LRU key competes with the main space's victim and the one
+// with the lower estimated frequency is evicted. The main space is a segmented LRU: keys hit while
+// on probation are promoted to the protected segment.
+type tinyLFUQueue struct {
+	window, probation, protected *lruQueue
+	sketch                       *countMinSketch
+	full                         bool
+}
+
+// NewTinyLFUPolicy returns a policy implementing the W-TinyLFU admission and eviction scheme.
+func NewTinyLFUPolicy() EvictionPolicy {
+	return &tinyLFUQueue{
+		window:    newLRUQueue(),
+		probation: newLRUQueue(),
+		protected: newLRUQueue(),
+		sketch:    newCountMinSketch(minSketchWidth),
+	}
+}
+
+func (q *tinyLFUQueue) len() int {
+	return q.window.len() + q.probation.len() + q.protected.len()
+}
+
+func (q *tinyLFUQueue) Add(key uint64) {
+	if q.window.contains(key) || q.probation.contains(key) || q.protected.contains(key) {
+		q.Access(key)
+		return
+	}
+
+	q.window.moveToFront(key)
+	if n := q.len(); n > q.sketch.width() {
+		// Grow the sketch along with the cache, the frequencies start over.
+		q.sketch = newCountMinSketch(2 * n)
+	}
+	q.sketch.increment(key)
+
+	for !q.full && q.window.len() > q.windowCap() {
+		overflow, _ := q.window.removeFromTail()
+		q.probation.moveToFront(overflow)
+	}
+}
+
+func (q *tinyLFUQueue) windowCap() int {
+	return max(q.len()/tinyLFUWindowRatio, 1)
+}
+
+func (q *tinyLFUQueue) Access(key uint64) {
+	q.sketch.increment(key)
+
+	switch {
+	case q.window.contains(key):
+		q.window.moveToFront(key)
+	case q.probation.contains(key):
+		q.probation.remove(key)
+		q.protected.moveToFront(key)
+		protectedCap := int(tinyLFUProtectedRatio * float64(q.probation.len()+q.protected.len()))
+		for q.protected.len() > max(protectedCap, 1) {
+			demoted, _ := q.protected.removeFromTail()
+			q.probation.moveToFront(demoted)
+		}
+	case q.protected.contains(key):
+		q.protected.moveToFront(key)
+	}
+}
+
+func (q *tinyLFUQueue) Remove(key uint64) {
+	q.window.remove(key)
+	q.probation.remove(key)
+	q.protected.remove(key)
+}
+
+func (q *tinyLFUQueue) Evict() (uint64, bool) {
+	q.full = true
+	if q.window.len() > q.windowCap() {
+		victims := q.probation
+		if victims.len() == 0 {
+			victims = q.protected
+		}
+		if victims.len() == 0 {
+			return q.window.removeFromTail()
+		}
+
+		candidate := q.window.tail.key
+		victim := victims.tail.key
+		if q.sketch.estimate(candidate) > q.sketch.estimate(victim) {
+			q.window.remove(candidate)
+			q.probation.moveToFront(candidate)
+			victims.remove(victim)
+			return victim, true
+		}
+
+		q.window.remove(candidate)
+		return candidate, true
+	}
+
+	for _, segment := range []*lruQueue{q.probation, q.protected, q.window} {
+		if key, ok := segment.removeFromTail(); ok {
+			return key, true
+		}
+	}
+	return 0, false
+}
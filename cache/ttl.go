@@ -0,0 +1,67 @@
+package cache
+
+import "time"
+
+// Peek returns the value of the key like Get, without counting as an access for the eviction policy,
+// the statistics, the sliding expiration or the refresh of the entry.
+func (c *engine[K, V]) Peek(key K) (V, bool) {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	entry := s.get(hashKey, key)
+	if entry == nil || entry.expired(c.clock.Now()) {
+		return zero[V](), false
+	}
+	return entry.data, true
+}
+
+// TTL returns the remaining lifetime of the key, or NoExpiration if it never expires.
+// It returns false if the key is not in the cache.
+func (c *engine[K, V]) TTL(key K) (time.Duration, bool) {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	now := c.clock.Now()
+	entry := s.get(hashKey, key)
+	if entry == nil || entry.expired(now) {
+		return 0, false
+	}
+	if entry.exp.IsZero() {
+		return NoExpiration, true
+	}
+	return entry.exp.Sub(now), true
+}
+
+// Touch makes the key expire after exp from now, or never with NoExpiration, see DefaultExpiration.
+// It returns false if the key is not in the cache.
+func (c *engine[K, V]) Touch(key K, exp time.Duration) bool {
+	hashKey := c.hasher(key)
+	s := c.shard(hashKey)
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	now := c.clock.Now()
+	entry := s.get(hashKey, key)
+	if entry == nil || entry.expired(now) {
+		return false
+	}
+
+	entry.ttl = c.jitter(resolveTTL(c.expirationPolicy, key, entry.data, exp, c.defaultTTL))
+	deadline, refresh := c.expiration(now, entry.ttl)
+	s.expire(entry, deadline, refresh)
+	return true
+}
+
+// SetDefault adds or updates a cache entry expiring after the default TTL, see DefaultExpiration.
+func (c *engine[K, V]) SetDefault(key K, data V) {
+	c.Set(key, data, DefaultExpiration)
+}
+
+// SetNoExpire adds or updates a cache entry that never expires.
+func (c *engine[K, V]) SetNoExpire(key K, data V) {
+	c.Set(key, data, NoExpiration)
+}
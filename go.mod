@@ -1,6 +1,6 @@
 module github.com/nqhuytb99/utils
 
-go 1.20
+go 1.24
 
 require (
 	github.com/DmitriyVTitov/size v1.5.0